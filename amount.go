@@ -0,0 +1,65 @@
+package stc
+
+import (
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"strings"
+)
+
+// An amount of an asset in stroops, where one unit of an asset (e.g.,
+// one lumen) is 10^7 stroops.  An Amount prints the same way amounts
+// are annotated in txrep, for instance "1,000.25e7" for 1000.25 units
+// (which is also valid scientific notation for the number of
+// stroops).  When scanned or unmarshaled, a decimal number without an
+// exponent is a number of units, so that "12.5", "12.5e7", and
+// "125000000e0" all mean 12.5 units.  Commas may separate groups of
+// three digits.
+type Amount int64
+
+func (a Amount) String() string {
+	return stcdetail.JsonInt64e7(a).String()
+}
+
+// Marshals an Amount as a plain decimal number of units, as horizon
+// does.
+func (a Amount) MarshalText() ([]byte, error) {
+	return stcdetail.JsonInt64e7(a).MarshalText()
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	v, err := stcdetail.ScaleParse(string(text), 7)
+	if err == nil {
+		*a = Amount(v)
+	}
+	return err
+}
+
+func (a *Amount) Scan(ss fmt.ScanState, _ rune) error {
+	bs, err := ss.Token(true, nil)
+	if err != nil {
+		return err
+	}
+	return a.UnmarshalText(bs)
+}
+
+// Parse an amount optionally followed by whitespace and an asset, as
+// in "1,000.25 USD:GBD3...", "12.5 native", or "12.5 XLM".  A code
+// with no issuer means the native asset (see Asset.Scan).  The
+// returned asset is nil if s does not specify one.
+func ParseAmount(s string) (Amount, *stx.Asset, error) {
+	fields := strings.Fields(s)
+	var a Amount
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, nil, fmt.Errorf("invalid amount %q", s)
+	} else if err := a.UnmarshalText([]byte(fields[0])); err != nil {
+		return 0, nil, err
+	} else if len(fields) == 1 {
+		return a, nil, nil
+	}
+	var asset stx.Asset
+	if _, err := fmt.Sscan(fields[1], &asset); err != nil {
+		return 0, nil, err
+	}
+	return a, &asset, nil
+}
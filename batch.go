@@ -0,0 +1,144 @@
+package stc
+
+import (
+	"context"
+	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Packs an arbitrary number of operations into as many transactions
+// as needed, since a single transaction can hold at most
+// MAX_OPS_PER_TX operations.  Operations stay in the order in which
+// they were added, and operations added together with AddGroup are
+// never split across transactions.  For example:
+//
+//	b := NewBatcher(net, payer)
+//	for _, emp := range employees {
+//		b.Add(nil, Payment{
+//			Destination: emp.Account,
+//			Asset:       NativeAsset(),
+//			Amount:      emp.Salary,
+//		})
+//	}
+//	txes, err := b.Build(nil)
+type Batcher struct {
+	Net *StellarNet
+
+	// Source account of every transaction.
+	Source stx.IsAccount
+
+	// Maximum number of operations per transaction, or 0 for
+	// MAX_OPS_PER_TX.
+	MaxOps int
+
+	// If non-nil, supplies the sequence numbers of the transactions.
+	// Otherwise, Build loads the source account from horizon.
+	Seq *SequenceTracker
+
+	groups [][]stx.Operation
+}
+
+// Create a Batcher for transactions with the given source account.
+func NewBatcher(net *StellarNet, source stx.IsAccount) *Batcher {
+	return &Batcher{Net: net, Source: source}
+}
+
+func (b *Batcher) maxOps() int {
+	if b.MaxOps > 0 && b.MaxOps < stx.MAX_OPS_PER_TX {
+		return b.MaxOps
+	}
+	return stx.MAX_OPS_PER_TX
+}
+
+// Add an operation, which may end up in any transaction.
+// sourceAccount may be nil, as with TransactionEnvelope.Append.
+func (b *Batcher) Add(sourceAccount *stx.MuxedAccount, body OperationBody) {
+	b.AddGroup(stx.Operation{
+		SourceAccount: sourceAccount,
+		Body:          body.To_Operation_Body(),
+	})
+}
+
+// Add operations that must all go in the same transaction (for
+// instance, creating an account and then establishing a trustline
+// for it).  Panics if the group has more operations than fit in one
+// transaction.
+func (b *Batcher) AddGroup(ops ...stx.Operation) {
+	if len(ops) > b.maxOps() {
+		xdr.XdrPanic("Batcher.AddGroup: group of %d operations exceeds %d",
+			len(ops), b.maxOps())
+	} else if len(ops) > 0 {
+		b.groups = append(b.groups, ops)
+	}
+}
+
+// Returns the number of operations added so far.
+func (b *Batcher) Len() int {
+	n := 0
+	for _, g := range b.groups {
+		n += len(g)
+	}
+	return n
+}
+
+// Split the operations into the lists for each transaction.  Fails if
+// a group no longer fits in one transaction because MaxOps was lowered
+// after it was added.
+func (b *Batcher) pack() ([][]stx.Operation, error) {
+	var ret [][]stx.Operation
+	var cur []stx.Operation
+	for _, g := range b.groups {
+		if len(g) > b.maxOps() {
+			return nil, fmt.Errorf("Batcher: group of %d operations "+
+				"exceeds %d", len(g), b.maxOps())
+		} else if len(cur)+len(g) > b.maxOps() && len(cur) > 0 {
+			ret = append(ret, cur)
+			cur = nil
+		}
+		cur = append(cur, g...)
+	}
+	if len(cur) > 0 {
+		ret = append(ret, cur)
+	}
+	return ret, nil
+}
+
+// Build unsigned transactions containing all the operations added so
+// far.  The transactions have consecutive sequence numbers, so must
+// be submitted in order, and each has its fee set by UpdateFee.
+// Fails if a group has more operations than MaxOps allows.  ctx may
+// be nil.
+func (b *Batcher) Build(ctx context.Context) ([]*TransactionEnvelope, error) {
+	packed, err := b.pack()
+	if err != nil || len(packed) == 0 {
+		return nil, err
+	}
+	var seq stx.SequenceNumber
+	if b.Seq == nil {
+		ae, err := b.Net.GetAccountEntryCtx(ctx, seqKey(b.Source))
+		if err != nil {
+			return nil, err
+		}
+		seq = ae.NextSeq()
+	}
+
+	ret := make([]*TransactionEnvelope, len(packed))
+	for i, ops := range packed {
+		e := NewTransactionEnvelope()
+		e.SetSourceAccount(b.Source)
+		e.V1().Tx.Operations = append([]stx.Operation(nil), ops...)
+		if b.Seq != nil {
+			if err := b.Seq.SetSeqNum(ctx, e); err != nil {
+				return nil, err
+			}
+		} else {
+			e.V1().Tx.SeqNum = seq + stx.SequenceNumber(i)
+		}
+		if err := b.Net.UpdateFee(ctx, e); err != nil {
+			return nil, err
+		}
+		ret[i] = e
+	}
+	return ret, nil
+}
@@ -0,0 +1,214 @@
+package stc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// A pool of channel accounts, which allow one account to have many
+// transactions in flight at once.  Each transaction posted through
+// the pool gets a free channel account as its transaction source
+// (which supplies the sequence number and pays the fee), while the
+// real account remains the source of every operation.  A ChannelPool
+// is safe for concurrent use.
+type ChannelPool struct {
+	Net *StellarNet
+
+	// Supplies sequence numbers for the channel accounts (and for the
+	// funding account in Bootstrap).
+	Seq *SequenceTracker
+
+	keys []PrivateKey
+	free chan int
+}
+
+// Create a ChannelPool using the given channel keys.
+func NewChannelPool(net *StellarNet, keys ...PrivateKey) *ChannelPool {
+	cp := &ChannelPool{
+		Net:  net,
+		Seq:  NewSequenceTracker(net, false),
+		keys: keys,
+		free: make(chan int, len(keys)),
+	}
+	for i := range keys {
+		cp.free <- i
+	}
+	return cp
+}
+
+// Create a ChannelPool with channel keys read from files by
+// LoadPrivateKey.
+func LoadChannelPool(net *StellarNet, files ...string) (*ChannelPool, error) {
+	keys := make([]PrivateKey, len(files))
+	for i, file := range files {
+		var err error
+		if keys[i], err = LoadPrivateKey(file); err != nil {
+			return nil, err
+		}
+	}
+	return NewChannelPool(net, keys...), nil
+}
+
+// Returns the accounts of the channels in the pool.
+func (cp *ChannelPool) Channels() []AccountID {
+	ret := make([]AccountID, len(cp.keys))
+	for i := range cp.keys {
+		ret[i] = cp.keys[i].Public()
+	}
+	return ret
+}
+
+// Wait for a free channel.  ctx may be nil.
+func (cp *ChannelPool) acquire(ctx context.Context) (int, error) {
+	if len(cp.keys) == 0 {
+		return 0, errors.New("ChannelPool has no channels")
+	} else if ctx == nil {
+		return <-cp.free, nil
+	}
+	select {
+	case i := <-cp.free:
+		return i, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Returns true if err, as returned by StellarNet.PostAndWait, shows
+// that the transaction made it into a ledger and so used up its
+// sequence number.
+func txIncluded(err error) bool {
+	if err == nil {
+		return true
+	}
+	f, ok := err.(TxFailure)
+	if !ok || f.TransactionResult == nil {
+		return false
+	}
+	switch f.Result.Code {
+	case stx.TxFAILED, stx.TxFEE_BUMP_INNER_FAILED:
+		return true
+	}
+	return false
+}
+
+// Post a transaction through a free channel, waiting for one if all
+// channels are busy, and wait for the outcome as with
+// StellarNet.PostAndWait.  The transaction must be unsigned, and its
+// source account must be the real account on whose behalf it is
+// being submitted.  PostAndWait modifies e: operations with no source
+// account get the real account as their source, the transaction
+// source becomes the channel account, the sequence number comes from
+// cp.Seq, and if the fee is zero it is set with UpdateFee.  The
+// transaction is then signed by the channel key and by each of
+// signers (which should include the real account's key), and the
+// channel is released once the outcome is known.  Unless the
+// transaction makes it into a ledger, the channel's sequence number is
+// reset in cp.Seq, since it may not have been used.  ctx may be nil.
+func (cp *ChannelPool) PostAndWait(ctx context.Context,
+	e *TransactionEnvelope,
+	signers ...stcdetail.PrivateKeyInterface) (
+	res *HorizonTxResult, err error) {
+	ops := e.Operations()
+	if ops == nil {
+		return nil, fmt.Errorf("ChannelPool cannot post envelope type %s",
+			e.Type)
+	} else if len(*e.Signatures()) > 0 {
+		return nil, errors.New("ChannelPool cannot post a signed transaction")
+	}
+	acct := *e.SourceAccount()
+	if acct.Type == stx.KEY_TYPE_ED25519 &&
+		*acct.Ed25519() == (stx.Uint256{}) {
+		return nil, errors.New("ChannelPool transaction has no source account")
+	}
+	for i := range *ops {
+		if (*ops)[i].SourceAccount == nil {
+			src := acct
+			(*ops)[i].SourceAccount = &src
+		}
+	}
+
+	i, err := cp.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { cp.free <- i }()
+	channel := cp.keys[i].Public()
+
+	e.SetSourceAccount(channel)
+	if err = cp.Seq.SetSeqNum(ctx, e); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !txIncluded(err) {
+			cp.Seq.Reset(ctx, channel)
+		}
+	}()
+	var fee uint32
+	if e.Type == stx.ENVELOPE_TYPE_TX {
+		fee = e.V1().Tx.Fee
+	} else {
+		fee = e.V0().Tx.Fee
+	}
+	if fee == 0 {
+		if err = cp.Net.UpdateFee(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+	if err = cp.Net.SignTx(cp.keys[i], e); err != nil {
+		return nil, err
+	}
+	for _, sk := range signers {
+		if err = cp.Net.SignTx(sk, e); err != nil {
+			return nil, err
+		}
+	}
+	return cp.Net.PostAndWait(ctx, e)
+}
+
+// Create and fund any channel accounts that do not yet exist, with a
+// single transaction from funder giving each new channel
+// startingBalance stroops.  Returns nil, nil if all the channels
+// already exist.  As in PostAndWait, the funder's sequence number is
+// reset in cp.Seq unless the transaction makes it into a ledger.  ctx
+// may be nil.
+func (cp *ChannelPool) Bootstrap(ctx context.Context,
+	funder stcdetail.PrivateKeyInterface,
+	startingBalance int64) (res *HorizonTxResult, err error) {
+	e := NewTransactionEnvelope()
+	e.SetSourceAccount(funder.Public())
+	for _, acct := range cp.Channels() {
+		if _, err := cp.Net.GetAccountEntryCtx(ctx,
+			acct.String()); err == nil {
+			continue
+		} else if !isNotFound(err) {
+			return nil, err
+		} else if len(*e.Operations()) >= stx.MAX_OPS_PER_TX {
+			return nil, fmt.Errorf("cannot create more than %d channels "+
+				"in one transaction", stx.MAX_OPS_PER_TX)
+		}
+		e.Append(nil, CreateAccount{
+			Destination:     acct,
+			StartingBalance: startingBalance,
+		})
+	}
+	if len(*e.Operations()) == 0 {
+		return nil, nil
+	}
+	if err = cp.Seq.SetSeqNum(ctx, e); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !txIncluded(err) {
+			cp.Seq.Reset(ctx, funder.Public())
+		}
+	}()
+	if err = cp.Net.UpdateFee(ctx, e); err != nil {
+		return nil, err
+	} else if err = cp.Net.SignTx(funder, e); err != nil {
+		return nil, err
+	}
+	return cp.Net.PostAndWait(ctx, e)
+}
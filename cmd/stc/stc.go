@@ -5,7 +5,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -115,6 +117,21 @@ func doKeyGen(outfile string) {
 	storeKey(outfile, NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519))
 }
 
+func doMnemonicKeyGen(outfile string, index uint32) {
+	if outfile != "" && FileExists(outfile) {
+		fmt.Fprintf(os.Stderr, "%s: file already exists\n", outfile)
+		os.Exit(1)
+	}
+	words := NewMnemonic()
+	sk, err := PrivateKeyFromMnemonic(words, "", index)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(words)
+	storeKey(outfile, sk)
+}
+
 func storeKey(outfile string, sk PrivateKey) {
 	if outfile == "" {
 		fmt.Println(sk)
@@ -174,10 +191,7 @@ func fixTx(net *StellarNet, e *TransactionEnvelope) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if h, err := net.GetFeeStats(); err == nil {
-			// 20 should be a parameter
-			e.SetFee(h.Percentile(20))
-		}
+		net.UpdateFee(nil, e)
 	}()
 	if !isZeroAccount(e.SourceAccount()) {
 		wg.Add(1)
@@ -197,6 +211,36 @@ func fixTx(net *StellarNet, e *TransactionEnvelope) {
 	wg.Wait()
 }
 
+// Wrap e in a fee bump paid by acct.  The fee per operation (counting
+// the fee bump as an extra operation) comes from net.FeeStrategy, but
+// is raised to the inner transaction's fee per operation if that is
+// higher.  Any Soroban resource fee is added on top.
+func feeBump(net *StellarNet, e *TransactionEnvelope, acct string) (
+	*TransactionEnvelope, error) {
+	var src MuxedAccount
+	if _, err := fmt.Sscan(acct, &src); err != nil {
+		return nil, err
+	} else if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		return nil, fmt.Errorf("transaction is already a fee bump")
+	}
+	ret := NewFeeBump(e, &src, 0)
+	if err := net.UpdateFee(nil, ret); err != nil {
+		return nil, err
+	}
+	inner := &ret.FeeBump().Tx.InnerTx.V1().Tx
+	if nops := int64(len(inner.Operations)); nops > 0 {
+		var resourceFee int64
+		if inner.Ext.V == 1 {
+			resourceFee = int64(inner.Ext.SorobanData().ResourceFee)
+		}
+		rate := (int64(inner.Fee) - resourceFee + nops - 1) / nops
+		if rate*(nops+1)+resourceFee > ret.FeeBump().Tx.Fee {
+			ret.SetFee(uint32(rate))
+		}
+	}
+	return ret, nil
+}
+
 // Guess whether input is key: value lines or compiled base64
 func guessFormat(content string) format {
 	if len(content) == 0 {
@@ -298,6 +342,28 @@ func mustWriteTx(outfile string, e *TransactionEnvelope, net *StellarNet,
 	}
 }
 
+// How long -wait polls for a transaction before giving up.
+const waitTimeout = 15 * time.Minute
+
+// Number of ledgers (about 8 minutes) for which -sign makes Soroban
+// authorization entries valid.
+const authLedgers = 100
+
+func latestLedger(net *StellarNet) (uint32, error) {
+	if net.RPC != "" {
+		l, err := net.RPCGetLatestLedger(nil)
+		if err != nil {
+			return 0, err
+		}
+		return l.Sequence, nil
+	}
+	h, err := net.GetLedgerHeader()
+	if err != nil {
+		return 0, err
+	}
+	return uint32(h.LedgerSeq), nil
+}
+
 func signTx(net *StellarNet, key string, e *TransactionEnvelope) error {
 	if key != "" {
 		key = AdjustKeyName(key)
@@ -307,6 +373,17 @@ func signTx(net *StellarNet, key string, e *TransactionEnvelope) error {
 		return err
 	}
 	net.AddSigner(sk.Public().String(), "")
+	if len(AuthEntriesFor(e, sk.Public())) > 0 {
+		ledger, err := latestLedger(net)
+		if err == nil {
+			_, err = net.SignAuthEntries(sk, e, ledger+authLedgers)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Signing authorization entries: %s\n",
+				err)
+			return err
+		}
+	}
 	if err = net.SignTx(sk, e); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return err
@@ -433,8 +510,9 @@ func doEdit(net *StellarNet, arg string) {
 	defer os.Remove(path)
 
 	var contents, lastcontents []byte
+	lint := false
 	for {
-		if err == nil {
+		if err == nil || lint {
 			lastcontents = []byte(net.TxToRep(e))
 			ioutil.WriteFile(path, lastcontents, 0600)
 		}
@@ -448,6 +526,9 @@ func doEdit(net *StellarNet, arg string) {
 		line := firstDifferentLine(contents, lastcontents)
 		if err != nil {
 			fmt.Fprint(os.Stderr, err.Error())
+			if lint {
+				fmt.Println("Quit the editor without changes to ignore.")
+			}
 			fmt.Printf("Press return to run editor.")
 			b := make([]byte, 1)
 			for n, err := os.Stdin.Read(b); err != nil && n > 0 && b[0] != '\n'; {
@@ -459,7 +540,7 @@ func doEdit(net *StellarNet, arg string) {
 		}
 		editor(path, line)
 
-		if err == nil {
+		if err == nil || lint {
 			fi2, staterr := os.Stat(path)
 			if staterr != nil {
 				fmt.Println(err.Error())
@@ -475,17 +556,35 @@ func doEdit(net *StellarNet, arg string) {
 			fmt.Fprintln(os.Stderr, err.Error())
 			os.Exit(1)
 		}
-		err = nil
+		err, lint = nil, false
 		if newe, pe := TxFromRep(string(contents)); pe != nil {
 			err = ParseError{pe.(stcdetail.TxrepError), path}
 		} else {
 			e = newe
+			if bad := draftProblems(net.ValidateTx(e)); len(bad) > 0 {
+				// Exiting the editor without changes accepts the warnings
+				rep := strings.NewReader(net.TxToRep(e))
+				err, lint = ParseError{bad.TxrepError(rep), path}, true
+			}
 		}
 	}
 
 	mustWriteTx(arg, e, net, txfmt)
 }
 
+// Drops the problems ValidateTx reports with the sequence number and
+// fee, which -edit users often fill in later with -u and -fee.
+func draftProblems(bad stcdetail.XdrBadValue) stcdetail.XdrBadValue {
+	var ret stcdetail.XdrBadValue
+	for _, b := range bad {
+		if !strings.HasSuffix(b.Field, ".seqNum") &&
+			!strings.HasSuffix(b.Field, ".fee") {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
 func b2i(bs ...bool) int {
 	ret := 0
 	for _, b := range bs {
@@ -496,18 +595,113 @@ func b2i(bs ...bool) int {
 	return ret
 }
 
-var progname string
+// Variables set with -D.
+type templateVars map[string]string
 
-var dateFormats = []string{
-	time.RFC3339,
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04",
-	"2006-01-02",
-	"20060102150405",
-	"200601021504",
-	"20060102",
+func (tv templateVars) String() string {
+	var kvs []string
+	for k, v := range tv {
+		kvs = append(kvs, k+"="+v)
+	}
+	return strings.Join(kvs, " ")
+}
+
+func (tv templateVars) Set(kv string) error {
+	i := strings.IndexByte(kv, '=')
+	if i <= 0 {
+		return fmt.Errorf("%q should be NAME=VALUE", kv)
+	}
+	tv[kv[:i]] = kv[i+1:]
+	return nil
 }
 
+// Read a transaction template (see RenderTxrepTemplate).
+func mustReadTemplate(infile string, vars templateVars) *TransactionEnvelope {
+	var f io.Reader = os.Stdin
+	if infile != "-" {
+		file, err := os.Open(infile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		f = file
+	} else {
+		infile = "(stdin)"
+	}
+	e, err := RenderTxrepTemplate(f, vars)
+	if te, ok := err.(stcdetail.TxrepError); ok {
+		fmt.Fprint(os.Stderr, te.FileError(infile))
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return e
+}
+
+// Read several copies of a transaction and merge their signatures.
+func mustMerge(net *StellarNet, infiles []string,
+	learn bool) *TransactionEnvelope {
+	envs := make([]*TransactionEnvelope, len(infiles))
+	for i, infile := range infiles {
+		envs[i], _ = mustReadTx(infile)
+	}
+	getAccounts(net, envs[0], learn)
+	e, err := MergeSignatures(net, envs...)
+	if me, ok := err.(MergeError); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", infiles[me.Index], me.Msg)
+		if strings.Contains(me.Msg, "known signer") && !learn {
+			fmt.Fprintln(os.Stderr,
+				"(Use -l to learn the signers of the accounts involved.)")
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return e
+}
+
+// Print the transaction requested by a SEP-7 URI, along with any
+// message and callback from the requester.
+func doFromURI(net *StellarNet, arg, signingKey, outfile string,
+	f format) {
+	u, err := ParseStellarURI(arg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	} else if u.Network() != net.GetNetworkId() {
+		fmt.Fprintf(os.Stderr, "URI is for network %q (use -net)\n",
+			u.Network())
+		os.Exit(1)
+	}
+	if signingKey != "" {
+		var pk PublicKey
+		if _, err := fmt.Sscan(signingKey, &pk); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid signing key %s\n", signingKey)
+			os.Exit(2)
+		} else if !u.Verify(pk) {
+			fmt.Fprintf(os.Stderr, "URI is not signed by %s\n", signingKey)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "origin_domain: %s (signature verified)\n",
+			u.OriginDomain)
+	} else if u.OriginDomain != "" {
+		fmt.Fprintf(os.Stderr, "origin_domain: %s (signature not verified)\n",
+			u.OriginDomain)
+	}
+	if u.Msg != "" {
+		fmt.Fprintf(os.Stderr, "msg: %s\n", u.Msg)
+	}
+	if u.Callback != "" {
+		fmt.Fprintf(os.Stderr, "callback: %s\n", u.Callback)
+	}
+	mustWriteTx(outfile, u.Envelope(), net, f)
+}
+
+var progname string
+
 func main() {
 	opt_compile := flag.Bool("c", false, "Compile output to base64 XDR")
 	opt_json := flag.Bool("json", false, "Output transaction in JSON format")
@@ -519,11 +713,19 @@ func main() {
 	opt_preauth := flag.Bool("preauth", false,
 		"Hash transaction to strkey for use as a pre-auth transaction signer")
 	opt_txhash := flag.Bool("txhash", false, "Hash transaction to hex format")
+	opt_uri := flag.Bool("uri", false,
+		"Output a SEP-7 web+stellar:tx URI for the transaction")
+	opt_from_uri := flag.Bool("from-uri", false,
+		"Convert a SEP-7 web+stellar: URI to a transaction")
 	opt_inplace := flag.Bool("i", false, "Edit the input file in place")
 	opt_sign := flag.Bool("sign", false, "Sign the transaction")
 	opt_payload := flag.String("payload", "false",
 		"Add signature on raw `HEX-STRING` instead of on this transaction")
 	opt_key := flag.String("key", "", "Use secret signing key in `FILE`")
+	opt_fee := flag.String("fee", "",
+		"Set fee according to `STRATEGY` (e.g., 500 or p50,surge=2,max=10000)")
+	opt_feebump := flag.String("feebump", "",
+		"Wrap transaction in a fee bump paid by `ACCOUNT`")
 	opt_netname := flag.String("net", "",
 		"Use Network `NET` (e.g., test); default: $STCNET or \"default\"")
 	opt_update := flag.Bool("u", false,
@@ -532,13 +734,27 @@ func main() {
 	opt_help := flag.Bool("help", false, "Print usage information")
 	opt_post := flag.Bool("post", false,
 		"Post transaction instead of editing it")
+	opt_sigcheck := flag.Bool("sigcheck", false,
+		"Query network to check whether transaction is sufficiently signed")
+	opt_check := flag.Bool("check", false,
+		"Check transaction for mistakes without querying the network")
+	opt_prepare := flag.Bool("prepare", false,
+		"Simulate Soroban transaction and fill in resources and fee")
+	opt_wait := flag.Bool("wait", false,
+		"With -post, wait for the transaction to be included in a ledger")
 	opt_nopass := flag.Bool("nopass", false, "Never prompt for passwords")
 	opt_edit := flag.Bool("edit", false,
 		"keep editing the file until it doesn't change")
 	opt_import_key := flag.Bool("import-key", false,
 		"Import signing key to your $STCDIR directory")
+	opt_mnemonic := flag.Bool("mnemonic", false,
+		"With -keygen or -import-key, use a SEP-5 mnemonic phrase")
+	opt_index := flag.Uint("index", 0,
+		"With -mnemonic, derive the key for account number `N`")
 	opt_export_key := flag.Bool("export-key", false,
 		"Export signing key from your $STCDIR directory")
+	opt_contract_spec := flag.Bool("contract-spec", false,
+		"List the functions of a Soroban contract WASM file")
 	opt_list_keys := flag.Bool("list-keys", false,
 		"List keys that have been stored in $STCDIR")
 	opt_fee_stats := flag.Bool("fee-stats", false,
@@ -571,6 +787,12 @@ func main() {
 		"Print the built-in stc.conf file used when none is found")
 	opt_zerosig := flag.Bool("z", false, "Zero out the signatures vector")
 	opt_opid := flag.Bool("opid", false, "Calculate a balance entry ID")
+	opt_merge := flag.Bool("merge", false,
+		"Merge the signatures of several copies of a transaction")
+	opt_template := flag.Bool("template", false,
+		"Read input as a transaction template with ${VAR} placeholders")
+	opt_vars := templateVars{}
+	flag.Var(opt_vars, "D", "Set template variable (`NAME=VALUE`)")
 	if pos := strings.LastIndexByte(os.Args[0], '/'); pos >= 0 {
 		progname = os.Args[0][pos+1:]
 	} else {
@@ -579,24 +801,36 @@ func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(),
 			`Usage: %[1]s [-net=ID] [-z] [-sign] [-c|-json] [-l] [-u] \
-           [-i | -o OUTPUT-FILE] INPUT-FILE
+           [-fee STRATEGY] [-feebump ACCOUNT] [-i | -o OUTPUT-FILE] \
+           INPUT-FILE
+       %[1]s -merge [-net=ID] [-l] [-sign] [-c|-json] [-o OUTPUT-FILE] \
+           INPUT-FILE INPUT-FILE...
+       %[1]s -template [-D NAME=VALUE]... [-net=ID] [-sign] [-c|-json] \
+           [-u] [-o OUTPUT-FILE] TEMPLATE-FILE
        %[1]s -edit [-net=ID] FILE
-       %[1]s -post [-net=ID] INPUT-FILE
+       %[1]s -post [-wait] [-net=ID] INPUT-FILE
+       %[1]s -prepare [-net=ID] FILE
+       %[1]s -check [-net=ID] INPUT-FILE
+       %[1]s -sigcheck [-net=ID] INPUT-FILE
        %[1]s -preauth [-net=ID] INPUT-FILE
        %[1]s -txhash [-net=ID] INPUT-FILE
+       %[1]s -uri [-net=ID] INPUT-FILE
+       %[1]s -from-uri [-net=ID] [-c|-json] [-o OUTPUT-FILE] URI \
+           [SIGNING-KEY]
        %[1]s -fee-stats
        %[1]s -ledger-header
        %[1]s -qa [-net=ID] ACCT
        %[1]s -qt [-net=ID] TXHASH
        %[1]s -qta [-net=ID] ACCT
        %[1]s -create [-net=ID] ACCT
-       %[1]s -keygen [NAME]
+       %[1]s -keygen [-mnemonic [-index N]] [NAME]
        %[1]s -genesis-key [NAME]
        %[1]s -pub [NAME]
-       %[1]s -import-key NAME
+       %[1]s -import-key [-mnemonic [-index N]] NAME
        %[1]s -export-key NAME
        %[1]s -list-keys
-       %[1]s -date YYYY-MM-DD[Thh:mm:ss[Z]]
+       %[1]s -contract-spec [-v] WASM-FILE
+       %[1]s -date {YYYY-MM-DD[Thh:mm:ss[Z]] | +DURATION}
        %[1]s -hint PUBKEY
        %[1]s -mux ACCT U64
        %[1]s -demux ACCT
@@ -622,12 +856,14 @@ func main() {
 		*opt_sign = true
 	}
 
-	nmode := b2i(*opt_preauth, *opt_txhash, *opt_post, *opt_edit,
-		*opt_keygen, *opt_genesis_key, *opt_date, *opt_sec2pub,
-		*opt_import_key, *opt_export_key, *opt_acctinfo, *opt_txinfo,
-		*opt_txacct, *opt_friendbot, *opt_list_keys, *opt_fee_stats,
+	nmode := b2i(*opt_preauth, *opt_txhash, *opt_post, *opt_prepare,
+		*opt_check, *opt_sigcheck, *opt_edit, *opt_keygen,
+		*opt_genesis_key, *opt_date, *opt_sec2pub, *opt_import_key,
+		*opt_export_key, *opt_acctinfo, *opt_txinfo, *opt_txacct,
+		*opt_friendbot, *opt_list_keys, *opt_fee_stats,
 		*opt_ledger_header, *opt_print_default_config, *opt_mux,
-		*opt_demux, *opt_pack, *opt_unpack, *opt_opid, *opt_hint)
+		*opt_demux, *opt_pack, *opt_unpack, *opt_opid, *opt_hint,
+		*opt_contract_spec, *opt_uri, *opt_from_uri)
 
 	argsMin, argsMax := 1, 1
 	switch {
@@ -640,6 +876,10 @@ func main() {
 		argsMin, argsMax = 2, 2
 	case *opt_opid:
 		argsMax, argsMax = 3, 3
+	case *opt_merge:
+		argsMin, argsMax = 2, len(flag.Args())
+	case *opt_from_uri:
+		argsMax = 2
 	}
 
 	if na := len(flag.Args()); nmode > 1 || na < argsMin || na > argsMax {
@@ -669,16 +909,28 @@ func main() {
 			fmt.Fprintln(os.Stderr, "-l and -u only availble in default mode")
 			bail = true
 		}
-		if *opt_inplace || *opt_output != "" {
-			fmt.Fprintln(os.Stderr, "-i and -o only availble in default mode")
+		if *opt_fee != "" || *opt_feebump != "" {
+			fmt.Fprintln(os.Stderr,
+				"-fee and -feebump only availble in default mode")
 			bail = true
 		}
-		if *opt_compile {
-			fmt.Fprintln(os.Stderr, "-c only availble in default mode")
+		if *opt_inplace {
+			fmt.Fprintln(os.Stderr, "-i only availble in default mode")
 			bail = true
 		}
-		if *opt_json {
-			fmt.Fprintln(os.Stderr, "-json only availble in default mode")
+		if *opt_output != "" && !*opt_from_uri {
+			fmt.Fprintln(os.Stderr,
+				"-o only availble in default mode and with -from-uri")
+			bail = true
+		}
+		if *opt_compile && !*opt_from_uri {
+			fmt.Fprintln(os.Stderr,
+				"-c only availble in default mode and with -from-uri")
+			bail = true
+		}
+		if *opt_json && !*opt_from_uri {
+			fmt.Fprintln(os.Stderr,
+				"-json only availble in default mode and with -from-uri")
 			bail = true
 		}
 		if *opt_zerosig {
@@ -692,6 +944,34 @@ func main() {
 		fmt.Fprintln(os.Stderr, "-i and -o are mutually exclusive")
 		os.Exit(2)
 	}
+	if *opt_merge && (nmode > 0 || *opt_inplace || *opt_template) {
+		fmt.Fprintln(os.Stderr,
+			"-merge only availble in default mode without -i or -template")
+		os.Exit(2)
+	}
+	if *opt_template && (*opt_edit || *opt_prepare || *opt_inplace) {
+		fmt.Fprintln(os.Stderr,
+			"-template incompatible with -edit, -prepare, and -i")
+		os.Exit(2)
+	} else if len(opt_vars) > 0 && !*opt_template {
+		fmt.Fprintln(os.Stderr, "-D only availble with -template")
+		os.Exit(2)
+	}
+	if *opt_mnemonic && !*opt_keygen && !*opt_import_key {
+		fmt.Fprintln(os.Stderr,
+			"-mnemonic only availble with -keygen and -import-key")
+		os.Exit(2)
+	} else if *opt_index != 0 && !*opt_mnemonic {
+		fmt.Fprintln(os.Stderr, "-index only availble with -mnemonic")
+		os.Exit(2)
+	} else if *opt_index >= 0x80000000 {
+		fmt.Fprintln(os.Stderr, "-index must be less than 2147483648")
+		os.Exit(2)
+	}
+	if *opt_wait && !*opt_post {
+		fmt.Fprintln(os.Stderr, "-wait only availble with -post")
+		os.Exit(2)
+	}
 
 	var arg string
 	if len(flag.Args()) >= 1 {
@@ -806,20 +1086,21 @@ func main() {
 		fmt.Printf("%s\n%x\n", pk, spl.Payload)
 		return
 	case *opt_date:
-		for _, f := range dateFormats {
-			t, err := time.ParseInLocation(f, arg, time.Local)
-			if err == nil {
-				fmt.Printf("%d\n", t.Unix())
-				return
-			}
+		t, err := stcdetail.ParseTimePoint(arg, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", progname, err)
+			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stderr, "%s: cannot parse date %q\n", progname, arg)
-		os.Exit(1)
+		fmt.Printf("%d\n", t)
 	case *opt_keygen:
 		if arg != "" {
 			arg = AdjustKeyName(arg)
 		}
-		doKeyGen(arg)
+		if *opt_mnemonic {
+			doMnemonicKeyGen(arg, uint32(*opt_index))
+		} else {
+			doKeyGen(arg)
+		}
 		return
 	case *opt_sec2pub:
 		if arg != "" {
@@ -829,7 +1110,19 @@ func main() {
 		return
 	case *opt_import_key:
 		arg = AdjustKeyName(arg)
-		sk, err := InputPrivateKey("Secret key: ")
+		var sk PrivateKey
+		var err error
+		if *opt_mnemonic {
+			words := stcdetail.GetPass("Mnemonic: ")
+			passphrase := stcdetail.GetPass("Mnemonic passphrase (if any): ")
+			sk, err = PrivateKeyFromMnemonic(string(words),
+				string(passphrase), uint32(*opt_index))
+			if err == nil {
+				fmt.Println(sk.Public())
+			}
+		} else {
+			sk, err = InputPrivateKey("Secret key: ")
+		}
 		if err == nil {
 			err = sk.Save(arg, stcdetail.GetPass2("Passphrase: "))
 		}
@@ -852,6 +1145,21 @@ func main() {
 			fmt.Println(k)
 		}
 		return
+	case *opt_contract_spec:
+		spec, err := LoadContractSpec(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		for _, f := range spec.Functions() {
+			if *opt_verbose && f.Doc != "" {
+				for _, line := range strings.Split(f.Doc, "\n") {
+					fmt.Println("///", line)
+				}
+			}
+			fmt.Println("fn", SpecFunctionString(f))
+		}
+		return
 	}
 
 	net := DefaultStellarNet(*opt_netname)
@@ -860,6 +1168,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *opt_fee != "" {
+		if err := net.FeeStrategy.UnmarshalText([]byte(*opt_fee));
+		err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
 	if *opt_genesis_key {
 		if arg != "" {
 			arg = AdjustKeyName(arg)
@@ -973,8 +1289,42 @@ func main() {
 		return
 	}
 
-	e, infmt := mustReadTx(arg)
+	if *opt_from_uri {
+		var signingKey string
+		if len(flag.Args()) > 1 {
+			signingKey = flag.Args()[1]
+		}
+		doFromURI(net, arg, signingKey, *opt_output, outfmt)
+		return
+	}
+
+	var e *TransactionEnvelope
+	var infmt format
+	if *opt_template {
+		e, infmt = mustReadTemplate(arg, opt_vars), fmt_txrep
+	} else if *opt_merge {
+		e, infmt = mustMerge(net, flag.Args(), *opt_learn), fmt_txrep
+	} else {
+		e, infmt = mustReadTx(arg)
+	}
 	switch {
+	case *opt_post && *opt_wait:
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+		txr, err := net.PostAndWait(ctx, e)
+		if txr != nil {
+			fmt.Print("==== RESULT ====\n", net.ToRep(&txr.Result),
+				"==== EFFECTS ====\n",
+				net.AccountDelta(&txr.StellarMetas, nil, ""))
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Gave up waiting for transaction %x\n"+
+				"(use -qt to check on it later)\n", *net.HashTx(e))
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Post transaction failed: %s\n", err)
+			os.Exit(1)
+		}
 	case *opt_post:
 		res, err := net.Post(e)
 		if err == nil {
@@ -983,8 +1333,47 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Post transaction failed: %s\n", err)
 			os.Exit(1)
 		}
+	case *opt_prepare:
+		if err := net.PrepareSoroban(nil, e); err != nil {
+			fmt.Fprintf(os.Stderr, "Prepare transaction failed: %s\n", err)
+			os.Exit(1)
+		}
+		if arg == "-" {
+			arg = ""
+		}
+		mustWriteTx(arg, e, net, infmt)
+	case *opt_check:
+		bad := net.ValidateTx(e)
+		if len(bad) == 0 {
+			return
+		}
+		if infmt == fmt_txrep && arg != "-" {
+			if f, err := os.Open(arg); err == nil {
+				fmt.Fprint(os.Stderr, bad.TxrepError(f).FileError(arg))
+				f.Close()
+				os.Exit(1)
+			}
+		}
+		fmt.Fprint(os.Stderr, bad.Error())
+		os.Exit(1)
+	case *opt_sigcheck:
+		sts, err := net.CheckSignatures(nil, e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Checking signatures failed: %s\n", err)
+			os.Exit(1)
+		}
+		ok := true
+		for i := range sts {
+			fmt.Println(&sts[i])
+			ok = ok && sts[i].Ok()
+		}
+		if !ok {
+			os.Exit(1)
+		}
 	case *opt_txhash:
 		fmt.Printf("%x\n", *net.HashTx(e))
+	case *opt_uri:
+		fmt.Println(net.TxURI(e))
 	case *opt_preauth:
 		sk := stx.SignerKey{Type: stx.SIGNER_KEY_TYPE_PRE_AUTH_TX}
 		*sk.PreAuthTx() = *net.HashTx(e)
@@ -996,6 +1385,19 @@ func main() {
 		}
 		if *opt_update {
 			fixTx(net, e)
+		} else if *opt_fee != "" && *opt_feebump == "" {
+			if err := net.UpdateFee(nil, e); err != nil {
+				fmt.Fprintf(os.Stderr, "Setting fee failed: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		if *opt_feebump != "" {
+			fb, err := feeBump(net, e, *opt_feebump)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Fee bump failed: %s\n", err)
+				os.Exit(1)
+			}
+			e = fb
 		}
 		if *opt_sign || *opt_key != "" {
 			var err error
@@ -29,15 +29,18 @@ native-asset = XLM
 
 [net "test"]
 horizon = https://horizon-testnet.stellar.org/
+rpc = https://soroban-testnet.stellar.org/
 native-asset = TestXLM
 
 [net "future"]
 horizon = https://horizon-futurenet.stellar.org/
+rpc = https://rpc-futurenet.stellar.org/
 native-asset = TestXLM
 
 [net "standalone"]
 network-id = "Standalone Network ; February 2017"
 horizon = http://localhost:8000/
+rpc = http://localhost:8000/rpc
 native-asset = StandaloneXLM
 
 `)
@@ -149,6 +152,16 @@ type stellarNetParser struct {
 	// tells us we need to save it to the configuration file.
 	// (setName means set it in the configuration file.)
 	setName bool
+
+	// Set at the end of the first file that configures horizon, so
+	// that lower-precedence files cannot add fallback servers.
+	horizonDone bool
+
+	// True once horizon-round-robin has been set.
+	roundRobinSet bool
+
+	// True once fee-percentile or max-fee has been set.
+	feePercentileSet, maxFeeSet bool
 }
 
 func (snp *stellarNetParser) Item(ii ini.IniItem) error {
@@ -171,7 +184,48 @@ func (snp *stellarNetParser) doNet(ii ini.IniItem) error {
 			snp.setName = false
 		}
 	case "horizon":
-		target = &snp.Horizon
+		if ii.Value == nil {
+			snp.Horizon, snp.HorizonFallbacks = "", nil
+			snp.horizonDone = false
+		} else if snp.Horizon == "" {
+			snp.Horizon = ii.Val()
+		} else if !snp.horizonDone {
+			snp.HorizonFallbacks = append(snp.HorizonFallbacks, ii.Val())
+		}
+	case "horizon-round-robin":
+		if ii.Value == nil {
+			snp.HorizonRoundRobin, snp.roundRobinSet = false, false
+		} else if !snp.roundRobinSet {
+			if _, err := fmt.Sscan(ii.Val(),
+				&snp.HorizonRoundRobin); err != nil {
+				return ini.BadValue(err.Error())
+			}
+			snp.roundRobinSet = true
+		}
+	case "fee-percentile":
+		if ii.Value == nil {
+			snp.FeeStrategy.Percentile, snp.feePercentileSet = 0, false
+		} else if !snp.feePercentileSet {
+			var p int
+			if _, err := fmt.Sscan(ii.Val(), &p); err != nil {
+				return ini.BadValue(err.Error())
+			} else if p < 1 || p > 99 {
+				return ini.BadValue("fee-percentile must be between 1 and 99")
+			}
+			snp.FeeStrategy.Percentile, snp.feePercentileSet = p, true
+		}
+	case "max-fee":
+		if ii.Value == nil {
+			snp.FeeStrategy.MaxFee, snp.maxFeeSet = 0, false
+		} else if !snp.maxFeeSet {
+			if _, err := fmt.Sscan(ii.Val(),
+				&snp.FeeStrategy.MaxFee); err != nil {
+				return ini.BadValue(err.Error())
+			}
+			snp.maxFeeSet = true
+		}
+	case "rpc":
+		target = &snp.RPC
 	case "native-asset":
 		target = &snp.NativeAsset
 	case "network-id":
@@ -230,6 +284,9 @@ func (snp *stellarNetParser) Section(iss ini.IniSecStart) error {
 }
 
 func (snp *stellarNetParser) Done(ini.IniRange) {
+	if snp.Horizon != "" {
+		snp.horizonDone = true
+	}
 	if snp.setName {
 		snp.Edits.Set("net", "name", snp.Name)
 		snp.setName = false
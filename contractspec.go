@@ -0,0 +1,722 @@
+package stc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"io/ioutil"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the WebAssembly custom section containing a contract's
+// spec entries.
+const ContractSpecSection = "contractspecv0"
+
+type noSuchFunction string
+
+func (e noSuchFunction) Error() string {
+	return fmt.Sprintf("Contract has no function %q", string(e))
+}
+
+type noSuchType string
+
+func (e noSuchType) Error() string {
+	return fmt.Sprintf("Contract spec has no type %q", string(e))
+}
+
+// The interface of a Soroban contract:  its functions and the
+// user-defined types they use.
+type ContractSpec struct {
+	Entries []stx.SCSpecEntry
+}
+
+// Decodes the spec entries embedded in the contractspecv0 custom
+// section of a contract's WebAssembly module.
+func ParseContractSpec(wasm []byte) (spec *ContractSpec, err error) {
+	sec, err := stcdetail.WasmCustomSection(wasm, ContractSpecSection)
+	if err != nil {
+		return nil, err
+	} else if sec == nil {
+		return nil, fmt.Errorf("WebAssembly module has no %s section",
+			ContractSpecSection)
+	}
+	defer func() {
+		if i := recover(); i != nil {
+			if xe, ok := i.(xdr.XdrError); ok {
+				spec, err = nil, xe
+				return
+			}
+			panic(i)
+		}
+	}()
+	spec = &ContractSpec{}
+	in := bytes.NewReader(sec)
+	for in.Len() > 0 {
+		var e stx.SCSpecEntry
+		e.XdrMarshal(&xdr.XdrIn{In: in}, "")
+		spec.Entries = append(spec.Entries, e)
+	}
+	return spec, nil
+}
+
+// Reads the spec of a contract from a WebAssembly file.
+func LoadContractSpec(path string) (*ContractSpec, error) {
+	wasm, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParseContractSpec(wasm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// Returns all the functions in a contract spec.
+func (s *ContractSpec) Functions() []*stx.SCSpecFunctionV0 {
+	var ret []*stx.SCSpecFunctionV0
+	for i := range s.Entries {
+		if s.Entries[i].Kind == stx.SC_SPEC_ENTRY_FUNCTION_V0 {
+			ret = append(ret, s.Entries[i].FunctionV0())
+		}
+	}
+	return ret
+}
+
+// Returns the function with a particular name, or nil if there is
+// none.
+func (s *ContractSpec) Function(name string) *stx.SCSpecFunctionV0 {
+	for _, f := range s.Functions() {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the definition of the user-defined type with a particular
+// name, or nil if there is none.
+func (s *ContractSpec) Type(name string) *stx.SCSpecEntry {
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		var n string
+		switch e.Kind {
+		case stx.SC_SPEC_ENTRY_UDT_STRUCT_V0:
+			n = e.UdtStructV0().Name
+		case stx.SC_SPEC_ENTRY_UDT_UNION_V0:
+			n = e.UdtUnionV0().Name
+		case stx.SC_SPEC_ENTRY_UDT_ENUM_V0:
+			n = e.UdtEnumV0().Name
+		case stx.SC_SPEC_ENTRY_UDT_ERROR_ENUM_V0:
+			n = e.UdtErrorEnumV0().Name
+		default:
+			continue
+		}
+		if n == name {
+			return e
+		}
+	}
+	return nil
+}
+
+var specTypeNames = map[stx.SCSpecType]string{
+	stx.SC_SPEC_TYPE_VAL:           "Val",
+	stx.SC_SPEC_TYPE_BOOL:          "bool",
+	stx.SC_SPEC_TYPE_VOID:          "()",
+	stx.SC_SPEC_TYPE_ERROR:         "Error",
+	stx.SC_SPEC_TYPE_U32:           "u32",
+	stx.SC_SPEC_TYPE_I32:           "i32",
+	stx.SC_SPEC_TYPE_U64:           "u64",
+	stx.SC_SPEC_TYPE_I64:           "i64",
+	stx.SC_SPEC_TYPE_TIMEPOINT:     "Timepoint",
+	stx.SC_SPEC_TYPE_DURATION:      "Duration",
+	stx.SC_SPEC_TYPE_U128:          "u128",
+	stx.SC_SPEC_TYPE_I128:          "i128",
+	stx.SC_SPEC_TYPE_U256:          "u256",
+	stx.SC_SPEC_TYPE_I256:          "i256",
+	stx.SC_SPEC_TYPE_BYTES:         "Bytes",
+	stx.SC_SPEC_TYPE_STRING:        "String",
+	stx.SC_SPEC_TYPE_SYMBOL:        "Symbol",
+	stx.SC_SPEC_TYPE_ADDRESS:       "Address",
+	stx.SC_SPEC_TYPE_MUXED_ADDRESS: "MuxedAddress",
+}
+
+// SCVal types of the spec types that are integers.
+var specIntTypes = map[stx.SCSpecType]stx.SCValType{
+	stx.SC_SPEC_TYPE_U32:       stx.SCV_U32,
+	stx.SC_SPEC_TYPE_I32:       stx.SCV_I32,
+	stx.SC_SPEC_TYPE_U64:       stx.SCV_U64,
+	stx.SC_SPEC_TYPE_I64:       stx.SCV_I64,
+	stx.SC_SPEC_TYPE_TIMEPOINT: stx.SCV_TIMEPOINT,
+	stx.SC_SPEC_TYPE_DURATION:  stx.SCV_DURATION,
+	stx.SC_SPEC_TYPE_U128:      stx.SCV_U128,
+	stx.SC_SPEC_TYPE_I128:      stx.SCV_I128,
+	stx.SC_SPEC_TYPE_U256:      stx.SCV_U256,
+	stx.SC_SPEC_TYPE_I256:      stx.SCV_I256,
+}
+
+// Renders a spec type using Rust syntax, as in the contract source.
+func SpecTypeString(t *stx.SCSpecTypeDef) string {
+	if n, ok := specTypeNames[t.Type]; ok {
+		return n
+	}
+	switch t.Type {
+	case stx.SC_SPEC_TYPE_OPTION:
+		return "Option<" + SpecTypeString(&t.Option().ValueType) + ">"
+	case stx.SC_SPEC_TYPE_RESULT:
+		return "Result<" + SpecTypeString(&t.Result().OkType) + ", " +
+			SpecTypeString(&t.Result().ErrorType) + ">"
+	case stx.SC_SPEC_TYPE_VEC:
+		return "Vec<" + SpecTypeString(&t.Vec().ElementType) + ">"
+	case stx.SC_SPEC_TYPE_MAP:
+		return "Map<" + SpecTypeString(&t.Map().KeyType) + ", " +
+			SpecTypeString(&t.Map().ValueType) + ">"
+	case stx.SC_SPEC_TYPE_TUPLE:
+		elts := make([]string, len(t.Tuple().ValueTypes))
+		for i := range elts {
+			elts[i] = SpecTypeString(&t.Tuple().ValueTypes[i])
+		}
+		return "(" + strings.Join(elts, ", ") + ")"
+	case stx.SC_SPEC_TYPE_BYTES_N:
+		return fmt.Sprintf("BytesN<%d>", t.BytesN().N)
+	case stx.SC_SPEC_TYPE_UDT:
+		return t.Udt().Name
+	}
+	return t.Type.String()
+}
+
+// Renders a function signature using Rust syntax, as in
+// "transfer(from: Address, to: Address, amount: i128)".
+func SpecFunctionString(f *stx.SCSpecFunctionV0) string {
+	out := strings.Builder{}
+	out.WriteString(f.Name)
+	out.WriteByte('(')
+	for i := range f.Inputs {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		fmt.Fprintf(&out, "%s: %s", f.Inputs[i].Name,
+			SpecTypeString(&f.Inputs[i].Type))
+	}
+	out.WriteByte(')')
+	if len(f.Outputs) > 0 {
+		out.WriteString(" -> ")
+		out.WriteString(SpecTypeString(&f.Outputs[0]))
+	}
+	return out.String()
+}
+
+func specErr(path string, format string, args ...interface{}) error {
+	return &SCValError{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Converts the arguments of a contract function to SCVals, checking
+// them against the function's spec.  See ContractSpec.ToSCVal for
+// the values accepted.
+func (s *ContractSpec) FunctionArgs(fn string,
+	args ...interface{}) ([]SCVal, error) {
+	f := s.Function(fn)
+	if f == nil {
+		return nil, noSuchFunction(fn)
+	} else if len(args) != len(f.Inputs) {
+		return nil, specErr("", "%s takes %d arguments, not %d",
+			SpecFunctionString(f), len(f.Inputs), len(args))
+	}
+	ret := make([]SCVal, len(args))
+	for i := range args {
+		var err error
+		if ret[i], err = s.toSCVal(&f.Inputs[i].Type, args[i],
+			f.Inputs[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Returns an InvokeHostFunction operation body calling function fn of
+// contract with the given arguments, which are converted with
+// FunctionArgs.  The operation still needs its footprint and
+// authorizations, which PrepareSoroban can supply.
+func (s *ContractSpec) Invoke(contract stx.SCAddress, fn string,
+	args ...interface{}) (*InvokeHostFunction, error) {
+	vals, err := s.FunctionArgs(fn, args...)
+	if err != nil {
+		return nil, err
+	}
+	ret := &InvokeHostFunction{}
+	ret.HostFunction.Type = stx.HOST_FUNCTION_TYPE_INVOKE_CONTRACT
+	*ret.HostFunction.InvokeContract() = stx.InvokeContractArgs{
+		ContractAddress: contract,
+		FunctionName:    fn,
+		Args:            vals,
+	}
+	return ret, nil
+}
+
+// Converts a value to an SCVal of spec type t.  v may be an SCVal,
+// which is used as is, or any Go value that ToSCVal accepts, which is
+// converted as t dictates rather than according to its Go type.  In
+// addition, a string can be used for any type:  Integers are parsed
+// in decimal (or in hex with prefix 0x), bytes in hex, addresses in
+// strkey format (G, C, M, B, or L), enums by case name or value,
+// unions without values by case name, and all other compound types
+// as JSON.  Vectors and tuples take slices, maps take maps, structs
+// take structs (with the same field names) or maps from field names
+// to values, and unions take a slice consisting of the case name
+// followed by the values.
+// Errors are of type *SCValError.
+func (s *ContractSpec) ToSCVal(t *stx.SCSpecTypeDef,
+	v interface{}) (SCVal, error) {
+	return s.toSCVal(t, v, "")
+}
+
+// Decodes JSON in a string argument if t is a compound type.
+func (s *ContractSpec) specJSON(t *stx.SCSpecTypeDef,
+	str string) (interface{}, bool) {
+	switch t.Type {
+	case stx.SC_SPEC_TYPE_VEC, stx.SC_SPEC_TYPE_MAP, stx.SC_SPEC_TYPE_TUPLE:
+	case stx.SC_SPEC_TYPE_UDT:
+		if !strings.HasPrefix(str, "[") && !strings.HasPrefix(str, "{") {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.UseNumber()
+	var ret interface{}
+	if dec.Decode(&ret) != nil {
+		return nil, false
+	}
+	return ret, true
+}
+
+// Returns the elements of a slice or array other than a byte slice.
+func specSlice(v interface{}) ([]interface{}, bool) {
+	if vs, ok := v.([]interface{}); ok {
+		return vs, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array ||
+		rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	ret := make([]interface{}, rv.Len())
+	for i := range ret {
+		ret[i] = rv.Index(i).Interface()
+	}
+	return ret, true
+}
+
+// Returns a struct or map with string keys as a map.
+func specFields(v interface{}) (map[string]interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	ret := make(map[string]interface{})
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		for it := rv.MapRange(); it.Next(); {
+			ret[it.Key().String()] = it.Value().Interface()
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.SplitN(f.Tag.Get("scval"), ",", 2)[0]
+			if f.PkgPath != "" || name == "-" {
+				continue
+			} else if name == "" {
+				name = f.Name
+			}
+			ret[name] = rv.Field(i).Interface()
+		}
+	default:
+		return nil, false
+	}
+	return ret, true
+}
+
+// Converts a Go integer, *big.Int, time, duration, JSON number, or
+// string to a big.Int.
+func specInt(v interface{}) (*big.Int, bool) {
+	switch x := v.(type) {
+	case *big.Int:
+		if x != nil {
+			return new(big.Int).Set(x), true
+		}
+		return nil, false
+	case time.Time:
+		return big.NewInt(x.Unix()), true
+	case time.Duration:
+		if x%time.Second != 0 {
+			return nil, false
+		}
+		return big.NewInt(int64(x / time.Second)), true
+	case json.Number:
+		return new(big.Int).SetString(string(x), 10)
+	case string:
+		return new(big.Int).SetString(strings.ReplaceAll(x, "_", ""), 0)
+	case float64:
+		if f := new(big.Float).SetFloat64(x); f.IsInt() {
+			ret, _ := f.Int(nil)
+			return ret, true
+		}
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return big.NewInt(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return new(big.Int).SetUint64(rv.Uint()), true
+	}
+	return nil, false
+}
+
+func (s *ContractSpec) toSCVal(t *stx.SCSpecTypeDef, v interface{},
+	path string) (ret SCVal, err error) {
+	wrong := func() (SCVal, error) {
+		return ret, specErr(path, "cannot convert %T to %s", v,
+			SpecTypeString(t))
+	}
+	switch x := v.(type) {
+	case SCVal:
+		return x, nil
+	case *SCVal:
+		if x != nil {
+			return *x, nil
+		}
+	case string:
+		if j, ok := s.specJSON(t, x); ok {
+			v = j
+		}
+	}
+	if n, ok := v.(json.Number); ok && t.Type != stx.SC_SPEC_TYPE_VAL {
+		if _, isInt := specIntTypes[t.Type]; !isInt {
+			v = string(n)
+		}
+	}
+
+	if st, ok := specIntTypes[t.Type]; ok {
+		x, ok := specInt(v)
+		if !ok {
+			return wrong()
+		} else if ret, err = stcdetail.BigToSCVal(x, st); err != nil {
+			return ret, specErr(path, "%s", err)
+		}
+		return ret, nil
+	}
+
+	str, isStr := v.(string)
+	switch t.Type {
+	case stx.SC_SPEC_TYPE_VAL:
+		if ret, err = stcdetail.ToSCVal(v); err != nil {
+			if serr, ok := err.(*SCValError); ok {
+				serr.Path = path + serr.Path
+			}
+		}
+		return
+	case stx.SC_SPEC_TYPE_BOOL:
+		b, ok := v.(bool)
+		if isStr {
+			var perr error
+			b, perr = strconv.ParseBool(str)
+			ok = perr == nil
+		}
+		if !ok {
+			return wrong()
+		}
+		ret.Type = stx.SCV_BOOL
+		*ret.B() = b
+		return
+	case stx.SC_SPEC_TYPE_VOID:
+		if v != nil {
+			return wrong()
+		}
+		ret.Type = stx.SCV_VOID
+		return
+	case stx.SC_SPEC_TYPE_BYTES, stx.SC_SPEC_TYPE_BYTES_N:
+		b, ok := v.([]byte)
+		if isStr {
+			var herr error
+			b, herr = hex.DecodeString(strings.TrimPrefix(str, "0x"))
+			if herr != nil {
+				return ret, specErr(path, "invalid hex bytes %q", str)
+			}
+		} else if rv := reflect.ValueOf(v); !ok &&
+			rv.Kind() == reflect.Array &&
+			rv.Type().Elem().Kind() == reflect.Uint8 {
+			b = make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+		} else if !ok {
+			return wrong()
+		}
+		if t.Type == stx.SC_SPEC_TYPE_BYTES_N &&
+			uint32(len(b)) != t.BytesN().N {
+			return ret, specErr(path, "%s requires %d bytes, not %d",
+				SpecTypeString(t), t.BytesN().N, len(b))
+		}
+		ret.Type = stx.SCV_BYTES
+		*ret.Bytes() = append([]byte{}, b...)
+		return
+	case stx.SC_SPEC_TYPE_STRING, stx.SC_SPEC_TYPE_SYMBOL:
+		if sym, ok := v.(Symbol); ok {
+			str, isStr = string(sym), true
+		}
+		if !isStr {
+			return wrong()
+		} else if t.Type == stx.SC_SPEC_TYPE_STRING {
+			ret.Type = stx.SCV_STRING
+			*ret.Str() = str
+		} else if err = stcdetail.CheckSymbol(str); err != nil {
+			return ret, specErr(path, "%s", err)
+		} else {
+			ret.Type = stx.SCV_SYMBOL
+			*ret.Sym() = str
+		}
+		return
+	case stx.SC_SPEC_TYPE_ADDRESS, stx.SC_SPEC_TYPE_MUXED_ADDRESS:
+		ret.Type = stx.SCV_ADDRESS
+		switch a := v.(type) {
+		case string:
+			if err = ret.Address().UnmarshalText([]byte(a)); err != nil {
+				return ret, specErr(path, "invalid address %q", a)
+			}
+		case stx.SCAddress:
+			*ret.Address() = a
+		case stx.AccountID:
+			ret.Address().Type = stx.SC_ADDRESS_TYPE_ACCOUNT
+			*ret.Address().AccountId() = a
+		default:
+			return wrong()
+		}
+		return
+	case stx.SC_SPEC_TYPE_OPTION:
+		if rv := reflect.ValueOf(v); !rv.IsValid() ||
+			rv.Kind() == reflect.Ptr && rv.IsNil() {
+			ret.Type = stx.SCV_VOID
+			return
+		}
+		return s.toSCVal(&t.Option().ValueType, v, path)
+	case stx.SC_SPEC_TYPE_VEC, stx.SC_SPEC_TYPE_TUPLE:
+		elts, ok := specSlice(v)
+		if !ok {
+			return wrong()
+		}
+		if t.Type == stx.SC_SPEC_TYPE_TUPLE &&
+			len(elts) != len(t.Tuple().ValueTypes) {
+			return ret, specErr(path, "%s requires %d elements, not %d",
+				SpecTypeString(t), len(t.Tuple().ValueTypes), len(elts))
+		}
+		vec := make(stx.SCVec, len(elts))
+		for i := range elts {
+			var et *stx.SCSpecTypeDef
+			if t.Type == stx.SC_SPEC_TYPE_VEC {
+				et = &t.Vec().ElementType
+			} else {
+				et = &t.Tuple().ValueTypes[i]
+			}
+			if vec[i], err = s.toSCVal(et, elts[i],
+				fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return
+			}
+		}
+		ret.Type = stx.SCV_VEC
+		*ret.Vec() = &vec
+		return
+	case stx.SC_SPEC_TYPE_MAP:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map {
+			return wrong()
+		}
+		m := make(stx.SCMap, 0, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			var e stx.SCMapEntry
+			kpath := fmt.Sprintf("%s[%v]", path, it.Key())
+			if e.Key, err = s.toSCVal(&t.Map().KeyType,
+				it.Key().Interface(), kpath); err != nil {
+				return
+			} else if e.Val, err = s.toSCVal(&t.Map().ValueType,
+				it.Value().Interface(), kpath); err != nil {
+				return
+			}
+			m = append(m, e)
+		}
+		if err = stcdetail.SortSCMap(m); err != nil {
+			return ret, specErr(path, "%s", err)
+		}
+		ret.Type = stx.SCV_MAP
+		*ret.Map() = &m
+		return
+	case stx.SC_SPEC_TYPE_UDT:
+		udt := s.Type(t.Udt().Name)
+		if udt == nil {
+			return ret, specErr(path, "%s", noSuchType(t.Udt().Name))
+		}
+		return s.udtToSCVal(udt, v, path)
+	}
+	return ret, specErr(path, "cannot pass values of type %s",
+		SpecTypeString(t))
+}
+
+// Converts a value to a user-defined type.
+func (s *ContractSpec) udtToSCVal(udt *stx.SCSpecEntry, v interface{},
+	path string) (ret SCVal, err error) {
+	switch udt.Kind {
+	case stx.SC_SPEC_ENTRY_UDT_STRUCT_V0:
+		st := udt.UdtStructV0()
+		fields, ok := specFields(v)
+		if !ok {
+			return ret, specErr(path, "cannot convert %T to struct %s",
+				v, st.Name)
+		}
+		for name := range fields {
+			found := false
+			for i := range st.Fields {
+				found = found || st.Fields[i].Name == name
+			}
+			if !found {
+				return ret, specErr(path, "struct %s has no field %q",
+					st.Name, name)
+			}
+		}
+		// Tuple structs have fields named 0, 1, ... and are vectors
+		tuple := len(st.Fields) > 0
+		vals := make([]SCVal, len(st.Fields))
+		for i := range st.Fields {
+			f := &st.Fields[i]
+			tuple = tuple && f.Name == strconv.Itoa(i)
+			fv, ok := fields[f.Name]
+			if !ok {
+				return ret, specErr(path, "missing field %q of struct %s",
+					f.Name, st.Name)
+			}
+			if vals[i], err = s.toSCVal(&f.Type, fv,
+				path+"."+f.Name); err != nil {
+				return
+			}
+		}
+		if tuple {
+			vec := stx.SCVec(vals)
+			ret.Type = stx.SCV_VEC
+			*ret.Vec() = &vec
+			return
+		}
+		m := make(stx.SCMap, len(vals))
+		for i := range vals {
+			m[i].Key.Type = stx.SCV_SYMBOL
+			*m[i].Key.Sym() = st.Fields[i].Name
+			m[i].Val = vals[i]
+		}
+		if err = stcdetail.SortSCMap(m); err != nil {
+			return ret, specErr(path, "%s", err)
+		}
+		ret.Type = stx.SCV_MAP
+		*ret.Map() = &m
+		return
+	case stx.SC_SPEC_ENTRY_UDT_UNION_V0:
+		un := udt.UdtUnionV0()
+		var args []interface{}
+		name, ok := v.(string)
+		if !ok {
+			if args, ok = specSlice(v); ok && len(args) > 0 {
+				name, ok = args[0].(string)
+				args = args[1:]
+			}
+		}
+		if !ok {
+			return ret, specErr(path, "union %s requires a case name "+
+				"or a slice of the case name and values", un.Name)
+		}
+		vec := stx.SCVec{SCVal{Type: stx.SCV_SYMBOL}}
+		*vec[0].Sym() = name
+		for i := range un.Cases {
+			c := &un.Cases[i]
+			switch {
+			case c.Kind == stx.SC_SPEC_UDT_UNION_CASE_VOID_V0 &&
+				c.VoidCase().Name == name:
+				if len(args) != 0 {
+					return ret, specErr(path, "case %s of union %s "+
+						"has no values", name, un.Name)
+				}
+			case c.Kind == stx.SC_SPEC_UDT_UNION_CASE_TUPLE_V0 &&
+				c.TupleCase().Name == name:
+				types := c.TupleCase().Type
+				if len(args) != len(types) {
+					return ret, specErr(path, "case %s of union %s "+
+						"requires %d values, not %d", name, un.Name,
+						len(types), len(args))
+				}
+				for j := range types {
+					var val SCVal
+					if val, err = s.toSCVal(&types[j], args[j],
+						fmt.Sprintf("%s.%s[%d]", path, name, j)); err != nil {
+						return
+					}
+					vec = append(vec, val)
+				}
+			default:
+				continue
+			}
+			ret.Type = stx.SCV_VEC
+			*ret.Vec() = &vec
+			return
+		}
+		return ret, specErr(path, "union %s has no case %q", un.Name, name)
+	case stx.SC_SPEC_ENTRY_UDT_ENUM_V0, stx.SC_SPEC_ENTRY_UDT_ERROR_ENUM_V0:
+		var tname string
+		type enumCase struct {
+			name  string
+			value uint32
+		}
+		var cases []enumCase
+		if udt.Kind == stx.SC_SPEC_ENTRY_UDT_ENUM_V0 {
+			tname = udt.UdtEnumV0().Name
+			for _, c := range udt.UdtEnumV0().Cases {
+				cases = append(cases, enumCase{c.Name, c.Value})
+			}
+		} else {
+			tname = udt.UdtErrorEnumV0().Name
+			for _, c := range udt.UdtErrorEnumV0().Cases {
+				cases = append(cases, enumCase{c.Name, c.Value})
+			}
+		}
+		x, isInt := specInt(v)
+		str, _ := v.(string)
+		for _, c := range cases {
+			if !(isInt && x.IsUint64() && x.Uint64() == uint64(c.value)) &&
+				!(str != "" && str == c.name) {
+				continue
+			}
+			if udt.Kind == stx.SC_SPEC_ENTRY_UDT_ENUM_V0 {
+				ret.Type = stx.SCV_U32
+				*ret.U32() = c.value
+			} else {
+				ret.Type = stx.SCV_ERROR
+				ret.Error().Type = stx.SCE_CONTRACT
+				*ret.Error().ContractCode() = c.value
+			}
+			return
+		}
+		return ret, specErr(path, "%v is not a case of %s", v, tname)
+	}
+	return ret, specErr(path, "cannot convert %T to %s", v, udt.Kind)
+}
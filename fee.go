@@ -0,0 +1,176 @@
+package stc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Percentile of recent fees a FeeStrategy pays by default.
+const DefaultFeePercentile = 20
+
+// Ledger capacity usage at or above which the network is considered
+// to be surge pricing, for the purposes of FeeStrategy.SurgeMultiplier.
+const SurgeCapacityUsage = 0.9
+
+// How to choose the per-operation inclusion fee for a transaction.
+// The zero value pays the DefaultFeePercentile of recent maximum fees.
+//
+// A FeeStrategy can be parsed from and rendered as a comma-separated
+// list of terms: a number for a fixed fee, "pN" or "max_fee.pN" for
+// the Nth percentile of recent maximum fees, "fee_charged.pN" for the
+// Nth percentile of fees actually charged, "surge=X" for the surge
+// multiplier, and "max=N" for the cap.  For example,
+// "p50,surge=2,max=10000".
+type FeeStrategy struct {
+	// If non-zero, pay this fixed fee per operation and ignore fee
+	// statistics (other than the cap).
+	Fixed uint32
+
+	// Percentile of recent fees to pay.  0 means
+	// DefaultFeePercentile.
+	Percentile int
+
+	// If true, use the distribution of fees charged rather than
+	// maximum fees offered.
+	Charged bool
+
+	// If greater than 0, multiply the percentile fee by this amount
+	// when the last ledger's capacity usage is at least
+	// SurgeCapacityUsage.
+	SurgeMultiplier float64
+
+	// If non-zero, never pay more than this fee per operation.
+	MaxFee uint32
+}
+
+// Returns the per-operation inclusion fee chosen by the strategy.
+// fs may be nil if the strategy has a fixed fee.  Never returns less
+// than the last ledger's base fee unless capped by MaxFee.
+func (s *FeeStrategy) BaseFee(fs *FeeStats) uint32 {
+	fee := s.Fixed
+	if fee == 0 && fs != nil {
+		p := s.Percentile
+		if p == 0 {
+			p = DefaultFeePercentile
+		}
+		if s.Charged {
+			fee = fs.Charged.Percentile(p)
+		} else {
+			fee = fs.Offered.Percentile(p)
+		}
+		if fee < fs.Last_ledger_base_fee {
+			fee = fs.Last_ledger_base_fee
+		}
+		if s.SurgeMultiplier > 0 &&
+			fs.Ledger_capacity_usage >= SurgeCapacityUsage {
+			if f := float64(fee) * s.SurgeMultiplier; f >= math.MaxUint32 {
+				fee = math.MaxUint32
+			} else {
+				fee = uint32(f)
+			}
+		}
+	}
+	if s.MaxFee != 0 && fee > s.MaxFee {
+		fee = s.MaxFee
+	}
+	return fee
+}
+
+func (s FeeStrategy) String() string {
+	var terms []string
+	if s.Fixed != 0 {
+		terms = append(terms, strconv.FormatUint(uint64(s.Fixed), 10))
+	} else if s.Percentile != 0 || s.Charged {
+		p := s.Percentile
+		if p == 0 {
+			p = DefaultFeePercentile
+		}
+		if s.Charged {
+			terms = append(terms, fmt.Sprintf("fee_charged.p%d", p))
+		} else {
+			terms = append(terms, fmt.Sprintf("p%d", p))
+		}
+	}
+	if s.SurgeMultiplier > 0 {
+		terms = append(terms, "surge="+
+			strconv.FormatFloat(s.SurgeMultiplier, 'g', -1, 64))
+	}
+	if s.MaxFee != 0 {
+		terms = append(terms, fmt.Sprintf("max=%d", s.MaxFee))
+	}
+	if len(terms) == 0 {
+		return fmt.Sprintf("p%d", DefaultFeePercentile)
+	}
+	return strings.Join(terms, ",")
+}
+
+type badFeeStrategy string
+
+func (e badFeeStrategy) Error() string {
+	return fmt.Sprintf("invalid fee strategy term %q", string(e))
+}
+
+// Parse a FeeStrategy from text (see FeeStrategy for the syntax).
+// Fields not mentioned in the text are left unchanged, except that
+// a fixed fee and a percentile replace each other.
+func (s *FeeStrategy) UnmarshalText(text []byte) error {
+	for _, term := range strings.Split(string(text), ",") {
+		term = strings.TrimSpace(term)
+		k, v := term, ""
+		if i := strings.IndexByte(term, '='); i >= 0 {
+			k, v = term[:i], term[i+1:]
+		}
+		switch {
+		case k == "surge":
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return badFeeStrategy(term)
+			}
+			s.SurgeMultiplier = f
+		case k == "max":
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return badFeeStrategy(term)
+			}
+			s.MaxFee = uint32(n)
+		case v != "":
+			return badFeeStrategy(term)
+		case strings.HasPrefix(k, "p"), strings.HasPrefix(k, "max_fee.p"),
+			strings.HasPrefix(k, "fee_charged.p"):
+			charged := strings.HasPrefix(k, "fee_charged.")
+			n, err := strconv.ParseUint(
+				k[strings.LastIndexByte(k, 'p')+1:], 10, 8)
+			if err != nil || n < 1 || n > 99 {
+				return badFeeStrategy(term)
+			}
+			s.Fixed, s.Percentile, s.Charged = 0, int(n), charged
+		default:
+			n, err := strconv.ParseUint(k, 10, 32)
+			if err != nil || n == 0 {
+				return badFeeStrategy(term)
+			}
+			s.Fixed, s.Percentile, s.Charged = uint32(n), 0, false
+		}
+	}
+	return nil
+}
+
+// Set the fee of a transaction according to net.FeeStrategy,
+// fetching fee statistics with GetFeeCacheCtx unless the strategy
+// has a fixed fee.  Any Soroban resource fee is preserved (see
+// TransactionEnvelope.SetFee).  ctx may be nil.
+func (net *StellarNet) UpdateFee(ctx context.Context,
+	e *TransactionEnvelope) error {
+	var fs *FeeStats
+	if net.FeeStrategy.Fixed == 0 {
+		var err error
+		if fs, err = net.GetFeeCacheCtx(ctx); err != nil {
+			return err
+		}
+	}
+	e.SetFee(net.FeeStrategy.BaseFee(fs))
+	return nil
+}
@@ -3,6 +3,7 @@ package stc
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,17 +33,30 @@ import (
 // misconfiguration.  However, if the horizon server is refusing TCP
 // connections, it may be undergoing maintenance.
 func IsTemporary(err error) bool {
-	dial_not_dns := false
-	for ; err != nil; err = errors.Unwrap(err) {
-		if t, ok := err.(interface{ Temporary() bool }); ok && t.Temporary() {
-			return true
-		} else if operr, ok := err.(*net.OpError); ok && operr.Op == "dial" {
-			dial_not_dns = true
-		} else if _, ok := err.(*net.DNSError); ok {
-			dial_not_dns = false
-		}
+	return stcdetail.IsTemporary(err)
+}
+
+// Specifies how to retry failed requests to horizon.  See
+// StellarNet.RetryPolicy.
+type RetryPolicy = stcdetail.RetryPolicy
+
+// The retry policy used when StellarNet.RetryPolicy is nil.  Makes up
+// to 4 attempts, waiting about 1, 2, and 4 seconds between them (or
+// as long as requested by a Retry-After header, giving up if that is
+// over 30 seconds), and retrying errors for which IsTemporary returns
+// true.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinDelay:    time.Second,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.25,
+}
+
+func (net *StellarNet) retryPolicy() *RetryPolicy {
+	if net.RetryPolicy != nil {
+		return net.RetryPolicy
 	}
-	return dial_not_dns
+	return &DefaultRetryPolicy
 }
 
 // A communication error with horizon
@@ -53,8 +68,136 @@ func (e horizonFailure) Error() string {
 
 const badHorizonURL horizonFailure = "Missing or invalid horizon URL"
 
-func getURL(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// A non-200 HTTP response from horizon.  The error string is the body
+// of the response, which horizon uses to describe the problem.
+type horizonHTTPError struct {
+	*stcdetail.HTTPerror
+}
+
+func (e horizonHTTPError) Error() string {
+	return string(e.Body)
+}
+
+func (e horizonHTTPError) Unwrap() error {
+	return e.HTTPerror
+}
+
+// How long to avoid a horizon server that failed, if other servers
+// are available.
+const horizonPenalty = 30 * time.Second
+
+// Health of horizon servers, shared by all StellarNets.
+var horizonHealth struct {
+	sync.Mutex
+	// Servers that recently failed, and when to stop avoiding them
+	down map[string]time.Time
+	// Counter for round-robin selection of servers
+	next int
+}
+
+// Returns true if err means the request could not be sent at all.
+func isDialError(err error) bool {
+	var operr *net.OpError
+	return errors.As(err, &operr) && operr.Op == "dial"
+}
+
+// Record the outcome of a request to the horizon server at base.
+// The server is considered down if err is temporary or a connection
+// could not be established.
+func markHorizon(base string, err error) {
+	horizonHealth.Lock()
+	defer horizonHealth.Unlock()
+	if err != nil && (IsTemporary(err) || isDialError(err)) {
+		if horizonHealth.down == nil {
+			horizonHealth.down = make(map[string]time.Time)
+		}
+		horizonHealth.down[base] = time.Now().Add(horizonPenalty)
+	} else {
+		delete(horizonHealth.down, base)
+	}
+}
+
+// Returns the base URLs of all configured horizon servers in the
+// order they should be tried.  Servers that recently failed go last.
+// If read is true and HorizonRoundRobin is set, successive calls
+// rotate through the healthy servers.
+func (net *StellarNet) horizonURLs(read bool) []string {
+	var healthy, down []string
+	now := time.Now()
+	horizonHealth.Lock()
+	defer horizonHealth.Unlock()
+	for _, base := range append([]string{net.Horizon},
+		net.HorizonFallbacks...) {
+		if base == "" {
+			continue
+		} else if t, ok := horizonHealth.down[base]; ok && now.Before(t) {
+			down = append(down, base)
+		} else {
+			healthy = append(healthy, base)
+		}
+	}
+	if read && net.HorizonRoundRobin && len(healthy) > 1 {
+		n := horizonHealth.next % len(healthy)
+		horizonHealth.next++
+		healthy = append(healthy[n:], healthy[:n]...)
+	}
+	return append(healthy, down...)
+}
+
+// Call fn with the base URL of successive horizon servers until one
+// works.  When read is true, moves on to the next server after any
+// temporary error.  Otherwise, moves on only if a connection could
+// not be established, so that the same request is never sent to two
+// servers.
+func (net *StellarNet) withHorizon(ctx context.Context, read bool,
+	fn func(base string) error) error {
+	urls := net.horizonURLs(read)
+	if len(urls) == 0 {
+		return badHorizonURL
+	}
+	var err error
+	for _, base := range urls {
+		err = fn(base)
+		if ctx != nil && ctx.Err() != nil {
+			break
+		}
+		markHorizon(base, err)
+		if err == nil || !isDialError(err) && !(read && IsTemporary(err)) {
+			break
+		}
+	}
+	return err
+}
+
+// Returns the HTTPClient field of the StellarNet, or
+// http.DefaultClient if HTTPClient is nil.
+func (net *StellarNet) httpClient() *http.Client {
+	if net.HTTPClient != nil {
+		return net.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Like http.NewRequest, but attaches ctx to the request unless ctx is
+// nil.
+func newRequest(ctx context.Context, method, url string,
+	body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	} else if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+	return req, nil
+}
+
+func (net *StellarNet) getURL(ctx context.Context, url string) (
+	[]byte, error) {
+	req, err := newRequest(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := net.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -64,22 +207,43 @@ func getURL(url string) ([]byte, error) {
 		return nil, err
 	}
 	if resp.StatusCode != 200 {
-		return nil, horizonFailure(body)
+		return nil, horizonHTTPError{&stcdetail.HTTPerror{
+			Resp: resp,
+			Body: body,
+		}}
 	}
 	return body, nil
 }
 
 // Send an HTTP request to horizon
 func (net *StellarNet) Get(query string) ([]byte, error) {
-	if net.Horizon == "" {
-		return nil, badHorizonURL
-	}
-	return getURL(net.Horizon + query)
+	return net.GetCtx(nil, query)
+}
+
+// Like Get, but the request can be canceled or given a deadline
+// through ctx (which may be nil).
+func (net *StellarNet) GetCtx(ctx context.Context, query string) (
+	[]byte, error) {
+	var body []byte
+	err := net.retryPolicy().Do(ctx, func() error {
+		return net.withHorizon(ctx, true, func(base string) (err error) {
+			body, err = net.getURL(ctx, base+query)
+			return
+		})
+	})
+	return body, err
 }
 
 // Send an HTTP request to horizon and perse the result as JSON
 func (net *StellarNet) GetJSON(query string, out interface{}) error {
-	if body, err := net.Get(query); err != nil {
+	return net.GetJSONCtx(nil, query, out)
+}
+
+// Like GetJSON, but the request can be canceled or given a deadline
+// through ctx (which may be nil).
+func (net *StellarNet) GetJSONCtx(ctx context.Context, query string,
+	out interface{}) error {
+	if body, err := net.GetCtx(ctx, query); err != nil {
 		return err
 	} else {
 		return json.Unmarshal(body, out)
@@ -126,31 +290,38 @@ func (net *StellarNet) StreamJSON(
 	}
 	tp = tp.In(0).Elem()
 
-	if net.Horizon == "" {
+	urls := net.horizonURLs(true)
+	if len(urls) == 0 {
 		return badHorizonURL
 	}
-	query = net.Horizon + query
+	base := urls[0]
 
 	netval := reflect.ValueOf(net)
-	return stcdetail.Stream(ctx, query, func(evtype string, data []byte) error {
-		switch evtype {
-		case "error":
-			return ErrEventStream(data)
-		case "message":
-			v := reflect.New(tp)
-			setField(v, "Net", netval)
-			if err := json.Unmarshal(data, v.Interface()); err != nil {
-				return err
-			}
-			errs := cbv.Call([]reflect.Value{v})
-			if len(errs) != 0 {
-				if err, ok := errs[0].Interface().(error); ok && err != nil {
+	err := stcdetail.StreamWithClient(ctx, net.httpClient(),
+		net.retryPolicy(), base+query,
+		func(evtype string, data []byte) error {
+			switch evtype {
+			case "error":
+				return ErrEventStream(data)
+			case "message":
+				v := reflect.New(tp)
+				setField(v, "Net", netval)
+				if err := json.Unmarshal(data, v.Interface()); err != nil {
 					return err
 				}
+				errs := cbv.Call([]reflect.Value{v})
+				if len(errs) != 0 {
+					if err, ok := errs[0].Interface().(error); ok && err != nil {
+						return err
+					}
+				}
 			}
-		}
-		return nil
-	})
+			return nil
+		})
+	if ctx == nil || ctx.Err() == nil {
+		markHorizon(base, err)
+	}
+	return err
 }
 
 type jsonInterface struct {
@@ -169,10 +340,6 @@ func (ji *jsonInterface) UnmarshalJSON(data []byte) error {
 // or the ctx argument is Done.
 func (net *StellarNet) IterateJSON(
 	ctx context.Context, query string, cb interface{}) error {
-	if net.Horizon == "" {
-		return badHorizonURL
-	}
-
 	var resp *http.Response
 	cleanup := func() {
 		if resp != nil && resp.Body != nil {
@@ -180,6 +347,18 @@ func (net *StellarNet) IterateJSON(
 		}
 	}
 	defer cleanup()
+	fetch := func(url string) error {
+		req, err := newRequest(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		cleanup()
+		resp, err = net.httpClient().Do(req)
+		if err == nil && resp.StatusCode != 200 {
+			err = stcdetail.NewHTTPerror(resp)
+		}
+		return err
+	}
 
 	cbv := reflect.ValueOf(cb)
 	tp := cbv.Type()
@@ -205,35 +384,20 @@ func (net *StellarNet) IterateJSON(
 
 	netval := reflect.ValueOf(net)
 
-	backoff := time.Second
-	for url := net.Horizon + query; ctx == nil || ctx.Err() == nil; url =
-		j.Links.Next.Href {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return err
-		} else if ctx != nil {
-			req = req.WithContext(ctx)
-		}
-		cleanup()
-		resp, err = http.DefaultClient.Do(req)
+	// The first page can come from any horizon server; subsequent
+	// pages come from wherever the previous page links.
+	for url := ""; ctx == nil || ctx.Err() == nil; url = j.Links.Next.Href {
+		err := net.retryPolicy().Do(ctx, func() error {
+			if url != "" {
+				return fetch(url)
+			}
+			return net.withHorizon(ctx, true, func(base string) error {
+				return fetch(base + query)
+			})
+		})
 		if err != nil || ctx != nil && ctx.Err() != nil {
 			return err
-		} else if resp.StatusCode != 200 {
-			if resp.StatusCode != 429 {
-				return stcdetail.NewHTTPerror(resp)
-			}
-			if ctx != nil {
-				select {
-				case <-ctx.Done():
-				case <-time.After(backoff):
-				}
-			} else {
-				time.Sleep(backoff)
-			}
-			backoff *= 2
-			continue
 		}
-		backoff = time.Second
 		dec := json.NewDecoder(resp.Body)
 		if err = dec.Decode(&j); err != nil {
 			return err
@@ -252,6 +416,9 @@ func (net *StellarNet) IterateJSON(
 				}
 			}
 		}
+		if j.Links.Next.Href == "" {
+			break
+		}
 	}
 	return nil
 }
@@ -391,8 +558,14 @@ func (ae *HorizonAccountEntry) UnmarshalJSON(data []byte) error {
 // network.
 func (net *StellarNet) GetAccountEntry(acct string) (
 	*HorizonAccountEntry, error) {
+	return net.GetAccountEntryCtx(nil, acct)
+}
+
+// Like GetAccountEntry, but takes a Context (which may be nil).
+func (net *StellarNet) GetAccountEntryCtx(ctx context.Context,
+	acct string) (*HorizonAccountEntry, error) {
 	ret := HorizonAccountEntry{Net: net}
-	if err := net.GetJSON("accounts/"+acct, &ret); err != nil {
+	if err := net.GetJSONCtx(ctx, "accounts/"+acct, &ret); err != nil {
 		return nil, err
 	}
 	return &ret, nil
@@ -559,8 +732,14 @@ func (r *HorizonTxResult) UnmarshalJSON(data []byte) error {
 }
 
 func (net *StellarNet) GetTxResult(txid string) (*HorizonTxResult, error) {
+	return net.GetTxResultCtx(nil, txid)
+}
+
+// Like GetTxResult, but takes a Context (which may be nil).
+func (net *StellarNet) GetTxResultCtx(ctx context.Context, txid string) (
+	*HorizonTxResult, error) {
 	ret := HorizonTxResult{Net: net}
-	if err := net.GetJSON("transactions/"+txid, &ret); err != nil {
+	if err := net.GetJSONCtx(ctx, "transactions/"+txid, &ret); err != nil {
 		return nil, err
 	}
 	return &ret, nil
@@ -790,9 +969,15 @@ func capitalize(s string) string {
 
 // Queries the network for the latest fee statistics.
 func (net *StellarNet) GetFeeStats() (*FeeStats, error) {
+	return net.GetFeeStatsCtx(nil)
+}
+
+// Like GetFeeStats, but takes a Context (which may be nil).
+func (net *StellarNet) GetFeeStatsCtx(ctx context.Context) (
+	*FeeStats, error) {
 	var ret FeeStats
 	now := time.Now()
-	if err := net.GetJSON("fee_stats", &ret); err != nil {
+	if err := net.GetJSONCtx(ctx, "fee_stats", &ret); err != nil {
 		return nil, err
 	}
 	net.FeeCache = &ret
@@ -802,16 +987,28 @@ func (net *StellarNet) GetFeeStats() (*FeeStats, error) {
 
 // Like GetFeeStats but a version cached for 1 minute
 func (net *StellarNet) GetFeeCache() (*FeeStats, error) {
+	return net.GetFeeCacheCtx(nil)
+}
+
+// Like GetFeeCache, but takes a Context (which may be nil).
+func (net *StellarNet) GetFeeCacheCtx(ctx context.Context) (
+	*FeeStats, error) {
 	now := time.Now()
 	if net.FeeCache != nil && now.Sub(net.FeeCacheTime) < 60*time.Second {
 		return net.FeeCache, nil
 	}
-	return net.GetFeeStats()
+	return net.GetFeeStatsCtx(ctx)
 }
 
 // Fetch the latest ledger header over the network.
 func (net *StellarNet) GetLedgerHeader() (*LedgerHeader, error) {
-	body, err := net.Get("ledgers?limit=1&order=desc")
+	return net.GetLedgerHeaderCtx(nil)
+}
+
+// Like GetLedgerHeader, but takes a Context (which may be nil).
+func (net *StellarNet) GetLedgerHeaderCtx(ctx context.Context) (
+	*LedgerHeader, error) {
+	body, err := net.GetCtx(ctx, "ledgers?limit=1&order=desc")
 	if err != nil {
 		return nil, err
 	}
@@ -914,37 +1111,291 @@ func (e TxFailure) Error() string {
 // contains the transaction result.
 func (net *StellarNet) Post(e *TransactionEnvelope) (
 	*TransactionResult, error) {
-	if net.Horizon == "" {
-		return nil, badHorizonURL
+	return net.PostCtx(nil, e)
+}
+
+// Like Post, but the submission can be canceled or given a deadline
+// through ctx (which may be nil).  Note that canceling the context
+// does not guarantee the transaction was not submitted.
+func (net *StellarNet) PostCtx(ctx context.Context, e *TransactionEnvelope) (
+	*TransactionResult, error) {
+	var ret *TransactionResult
+	err := net.withSubmit(ctx, func(base string) (err error) {
+		ret, err = net.post(ctx, base, e)
+		return
+	})
+	return ret, err
+}
+
+// Call fn to submit a transaction to a horizon server, retrying
+// according to the RetryPolicy.  Once a request may have reached a
+// server, sticks with that server.  Resubmitting the same transaction
+// to it is harmless, since a transaction can only execute once.
+func (net *StellarNet) withSubmit(ctx context.Context,
+	fn func(base string) error) error {
+	var sticky string
+	return net.retryPolicy().Do(ctx, func() error {
+		if sticky != "" {
+			err := fn(sticky)
+			markHorizon(sticky, err)
+			return err
+		}
+		return net.withHorizon(ctx, false, func(base string) error {
+			err := fn(base)
+			if err == nil || !isDialError(err) {
+				sticky = base
+			}
+			return err
+		})
+	})
+}
+
+// Returned by PostAndWait when a transaction can no longer be
+// included in a ledger.
+var ErrTxExpired = errors.New(
+	"Transaction expired before it was included in a ledger")
+
+// How often PostAndWait polls horizon for a transaction.
+const postPollInterval = 2 * time.Second
+
+// How long PostAndWait polls for a transaction that has no upper time
+// bound, unless ctx has its own deadline.
+var PostWaitTimeout = 5 * time.Minute
+
+// Returns true if err is a 404 (Not Found) response from horizon.
+func isNotFound(err error) bool {
+	var herr *stcdetail.HTTPerror
+	return errors.As(err, &herr) &&
+		herr.Resp.StatusCode == http.StatusNotFound
+}
+
+// Post a transaction and wait for its final outcome.  If the
+// submission times out or otherwise has an unknown result, polls
+// horizon until the transaction appears in a ledger, or until the
+// ledger close time passes the transaction's upper time bound (in
+// which case the error is ErrTxExpired).  A transaction with no upper
+// time bound could appear at any time, so if ctx has no deadline,
+// polling stops after PostWaitTimeout with an error wrapping
+// context.DeadlineExceeded.  If the transaction is rejected, the error
+// is of type TxFailure.  If the transaction makes it into a ledger but
+// fails, returns both the HorizonTxResult and a TxFailure.  ctx may be
+// nil, but otherwise allows the wait to be canceled.
+func (net *StellarNet) PostAndWait(ctx context.Context,
+	e *TransactionEnvelope) (*HorizonTxResult, error) {
+	txid := hex.EncodeToString(net.HashTx(e)[:])
+	_, err := net.PostCtx(ctx, e)
+	var herr *stcdetail.HTTPerror
+	if f, ok := err.(TxFailure); ok {
+		switch f.Result.Code {
+		case stx.TxFAILED, stx.TxFEE_BUMP_INNER_FAILED:
+			// Failed transactions are still included in a ledger, so
+			// fall through to fetch the metadata.
+		default:
+			return nil, err
+		}
+	} else if err == badHorizonURL ||
+		errors.As(err, &herr) && !herr.Temporary() ||
+		ctx != nil && ctx.Err() != nil {
+		return nil, err
+	}
+
+	var maxTime uint64
+	if tb := e.TimeBounds(); tb != nil {
+		maxTime = uint64(tb.MaxTime)
+	}
+	if maxTime == 0 {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, PostWaitTimeout)
+			defer cancel()
+		}
+	}
+	for {
+		// Check for expiration before looking for the transaction, in
+		// case it gets included in the ledger that expires it.
+		expired := false
+		if maxTime != 0 {
+			if lh, err := net.GetLedgerHeaderCtx(ctx); err == nil {
+				expired = uint64(lh.ScpValue.CloseTime) > maxTime
+			}
+		}
+		res, err := net.GetTxResultCtx(ctx, txid)
+		switch {
+		case err == nil:
+			switch res.Result.Result.Code {
+			case stx.TxSUCCESS, stx.TxFEE_BUMP_INNER_SUCCESS:
+				return res, nil
+			}
+			return res, TxFailure{&res.Result}
+		case ctx != nil && ctx.Err() != nil,
+			!isNotFound(err) && !IsTemporary(err):
+			return nil, err
+		case expired:
+			return nil, ErrTxExpired
+		}
+		if ctx == nil {
+			time.Sleep(postPollInterval)
+		} else {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(postPollInterval):
+			}
+		}
 	}
+}
+
+func (net *StellarNet) post(ctx context.Context, base string,
+	e *TransactionEnvelope) (*TransactionResult, error) {
 	tx := stcdetail.XdrToBase64(e)
-	resp, err := http.PostForm(net.Horizon+"transactions/",
-		url.Values{"tx": {tx}})
+	req, err := newRequest(ctx, "POST", base+"transactions/",
+		strings.NewReader(url.Values{"tx": {tx}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := net.httpClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	js := json.NewDecoder(resp.Body)
 	var res struct {
 		Result_xdr string
 		Extras     struct {
 			Result_xdr string
 		}
 	}
-	if err = js.Decode(&res); err != nil {
-		return nil, err
-	}
+	err = json.Unmarshal(body, &res)
 	if res.Result_xdr == "" {
 		res.Result_xdr = res.Extras.Result_xdr
 	}
+	if res.Result_xdr == "" && resp.StatusCode != 200 {
+		return nil, horizonHTTPError{&stcdetail.HTTPerror{
+			Resp: resp,
+			Body: body,
+		}}
+	} else if err != nil {
+		return nil, err
+	}
 
 	var ret TransactionResult
 	if err = stcdetail.XdrFromBase64(&ret, res.Result_xdr); err != nil {
 		return nil, err
 	}
-	if ret.Result.Code != stx.TxSUCCESS {
+	if c := ret.Result.Code; c != stx.TxSUCCESS &&
+		c != stx.TxFEE_BUMP_INNER_SUCCESS {
 		return nil, TxFailure{&ret}
 	}
 	return &ret, nil
 }
+
+// Status of a transaction submitted with PostAsync.
+type AsyncTxStatus int
+
+const (
+	// The transaction was accepted for inclusion in a future ledger.
+	AsyncPending AsyncTxStatus = iota
+	// The transaction was already submitted.
+	AsyncDuplicate
+	// The transaction could not be accepted right now (e.g., because
+	// another transaction from the same account is pending) and
+	// should be submitted again later.
+	AsyncTryAgainLater
+	// The transaction was rejected.
+	AsyncError
+)
+
+var asyncTxStatusNames = [...]string{
+	AsyncPending:       "PENDING",
+	AsyncDuplicate:     "DUPLICATE",
+	AsyncTryAgainLater: "TRY_AGAIN_LATER",
+	AsyncError:         "ERROR",
+}
+
+func parseAsyncTxStatus(s string) (AsyncTxStatus, bool) {
+	for i := range asyncTxStatusNames {
+		if asyncTxStatusNames[i] == s {
+			return AsyncTxStatus(i), true
+		}
+	}
+	return AsyncError, false
+}
+
+func (s AsyncTxStatus) String() string {
+	if s >= 0 && int(s) < len(asyncTxStatusNames) {
+		return asyncTxStatusNames[s]
+	}
+	return fmt.Sprintf("AsyncTxStatus(%d)", int(s))
+}
+
+// Submit a transaction without waiting for it to be included in a
+// ledger, using horizon's asynchronous submission endpoint.  When
+// the status is AsyncError, the error is a TxFailure containing the
+// reason the transaction was rejected.  Use GetTxResult or
+// PostAndWait to learn the outcome of a pending transaction.  ctx may
+// be nil.
+func (net *StellarNet) PostAsync(ctx context.Context,
+	e *TransactionEnvelope) (AsyncTxStatus, error) {
+	var ret AsyncTxStatus
+	err := net.withSubmit(ctx, func(base string) (err error) {
+		ret, err = net.postAsync(ctx, base, e)
+		return
+	})
+	return ret, err
+}
+
+func (net *StellarNet) postAsync(ctx context.Context, base string,
+	e *TransactionEnvelope) (AsyncTxStatus, error) {
+	tx := stcdetail.XdrToBase64(e)
+	req, err := newRequest(ctx, "POST", base+"transactions_async",
+		strings.NewReader(url.Values{"tx": {tx}}.Encode()))
+	if err != nil {
+		return AsyncError, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := net.httpClient().Do(req)
+	if err != nil {
+		return AsyncError, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return AsyncError, err
+	}
+
+	var res struct {
+		Tx_status        string
+		ErrorResultXdr   string
+		Error_result_xdr string
+	}
+	json.Unmarshal(body, &res)
+	if status, ok := parseAsyncTxStatus(res.Tx_status); ok &&
+		status != AsyncError {
+		return status, nil
+	} else if ok {
+		if res.ErrorResultXdr == "" {
+			res.ErrorResultXdr = res.Error_result_xdr
+		}
+		var ret TransactionResult
+		if err = stcdetail.XdrFromBase64(&ret,
+			res.ErrorResultXdr); err != nil {
+			return AsyncError, err
+		}
+		return AsyncError, TxFailure{&ret}
+	} else if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return AsyncError, horizonHTTPError{&stcdetail.HTTPerror{
+			Resp: resp,
+			Body: body,
+		}}
+	}
+	return AsyncError, horizonFailure(
+		fmt.Sprintf("Unknown transaction status %q", res.Tx_status))
+}
@@ -0,0 +1,70 @@
+package stc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Error returned by MergeSignatures, identifying the envelope with the
+// problem by its position in the argument list.
+type MergeError struct {
+	Index int
+	Msg   string
+}
+
+func (e MergeError) Error() string {
+	return fmt.Sprintf("envelope %d: %s", e.Index, e.Msg)
+}
+
+// Combine the signatures on several copies of the same transaction,
+// such as copies signed separately by the different signers of a
+// multisig account.  Returns a new envelope containing the
+// transaction and the union of all the copies' signatures, with
+// duplicates removed.  Fails with a MergeError if any copy has a
+// different transaction hash from the first, or if any signature does
+// not verify against a signer in net.Signers (see SignerCache.Lookup).
+// The input envelopes are not modified.
+func MergeSignatures(net *StellarNet,
+	envs ...*TransactionEnvelope) (*TransactionEnvelope, error) {
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("MergeSignatures: no envelopes")
+	}
+	ret := &TransactionEnvelope{TransactionEnvelope: &stx.TransactionEnvelope{}}
+	if err := stcdetail.XdrFromBin(ret.TransactionEnvelope,
+		stcdetail.XdrToBin(envs[0])); err != nil {
+		return nil, err
+	}
+	sigs := ret.Signatures()
+	*sigs = nil
+
+	hash := *net.HashTx(envs[0])
+	networkID := net.GetNetworkId()
+	for i, e := range envs {
+		if h := net.HashTx(e); *h != hash {
+			return nil, MergeError{i, fmt.Sprintf(
+				"transaction hash %x does not match %x", h[:], hash[:])}
+		}
+	sigloop:
+		for j := range *e.Signatures() {
+			ds := &(*e.Signatures())[j]
+			for k := range *sigs {
+				if (*sigs)[k].Hint == ds.Hint &&
+					bytes.Equal((*sigs)[k].Signature, ds.Signature) {
+					continue sigloop
+				}
+			}
+			if net.Signers.Lookup(networkID, e.TransactionEnvelope,
+				ds) == nil {
+				return nil, MergeError{i, fmt.Sprintf(
+					"signature %d (hint %x) is not from a known signer",
+					j, ds.Hint[:])}
+			} else if len(*sigs) >= 20 {
+				return nil, MergeError{i, "more than 20 signatures"}
+			}
+			*sigs = append(*sigs, *ds)
+		}
+	}
+	return ret, nil
+}
@@ -3,6 +3,7 @@ package stc
 import (
 	"bytes"
 	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/xdrpp/stc/stcdetail"
@@ -53,6 +54,29 @@ func NewPrivateKey(pkt stx.PublicKeyType) PrivateKey {
 	}
 }
 
+// Generates a random 24-word BIP-39 mnemonic, from which keys can be
+// derived with PrivateKeyFromMnemonic.
+func NewMnemonic() string {
+	entropy := make([]byte, 32)
+	if _, err := rand.Read(entropy); err != nil {
+		panic(err)
+	}
+	return stcdetail.EntropyToMnemonic(entropy)
+}
+
+// Derives the key of account number index from a BIP-39 mnemonic and
+// optional passphrase as specified by SEP-5, using SLIP-0010
+// derivation path m/44'/148'/index'.  This yields the same keys as
+// wallets that support SEP-5 backup phrases.
+func PrivateKeyFromMnemonic(words, passphrase string,
+	index uint32) (PrivateKey, error) {
+	if _, err := stcdetail.MnemonicToEntropy(words); err != nil {
+		return PrivateKey{}, err
+	}
+	seed := stcdetail.MnemonicSeed(strings.ToLower(words), passphrase)
+	return PrivateKey{stcdetail.SLIP10Ed25519(seed, 44, 148, index)}, nil
+}
+
 // Writes the a private key to a file in strkey format.  If passphrase
 // has non-zero length, then the key is symmetrically encrypted in
 // ASCII-armored GPG format.
@@ -0,0 +1,604 @@
+package stc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"sync/atomic"
+	"time"
+)
+
+// A communication error with a Soroban RPC server
+type rpcFailure string
+
+func (e rpcFailure) Error() string {
+	return string(e)
+}
+
+const badRPCURL rpcFailure = "Missing or invalid Soroban RPC URL"
+
+// An error object returned by a Soroban RPC server.
+type RPCError struct {
+	Code    int
+	Message string
+	Data    json.RawMessage
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Returned (along with the result) when transaction simulation
+// fails.
+type SimulationError string
+
+func (e SimulationError) Error() string {
+	return "Simulation failed: " + string(e)
+}
+
+var rpcID uint64
+
+// Call method on the Soroban RPC server configured in net.RPC.
+// params is marshaled to JSON (and omitted if nil), and the result is
+// unmarshaled into result (unless result is nil).  If the server
+// returns an error object, the error is of type *RPCError.  ctx may be
+// nil.  Requests are retried according to net.RetryPolicy.
+func (net *StellarNet) RPCCall(ctx context.Context, method string,
+	params, result interface{}) error {
+	if net.RPC == "" {
+		return badRPCURL
+	}
+	body, err := json.Marshal(struct {
+		Jsonrpc string      `json:"jsonrpc"`
+		Id      uint64      `json:"id"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{"2.0", atomic.AddUint64(&rpcID, 1), method, params})
+	if err != nil {
+		return err
+	}
+	return net.retryPolicy().Do(ctx, func() error {
+		req, err := newRequest(ctx, "POST", net.RPC, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := net.httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return stcdetail.NewHTTPerror(resp)
+		}
+		var res struct {
+			Result json.RawMessage
+			Error  *RPCError
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return err
+		} else if res.Error != nil {
+			return res.Error
+		} else if result == nil {
+			return nil
+		}
+		return json.Unmarshal(res.Result, result)
+	})
+}
+
+// A JSON string containing base64-encoded XDR, which gets unmarshaled
+// into the XdrType.  An empty string leaves the XdrType unmodified.
+type jsonXdr struct {
+	xdr.XdrType
+}
+
+func (j jsonXdr) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	} else if s == "" {
+		return nil
+	}
+	return stcdetail.XdrFromBase64(j.XdrType, s)
+}
+
+// Unmarshal a list of base64-encoded XDR strings into the XDR values
+// returned by elt(0), elt(1), ...
+func xdrsFromBase64(in []string, elt func(i int) xdr.XdrType) error {
+	for i := range in {
+		if err := stcdetail.XdrFromBase64(elt(i), in[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse a time in seconds since the Unix epoch, as a string or
+// number.
+func parseUnixTime(js json.RawMessage) (time.Time, error) {
+	var n json.Number
+	if len(js) == 0 {
+		return time.Time{}, nil
+	} else if err := json.Unmarshal(js, &n); err != nil {
+		return time.Time{}, err
+	} else if secs, err := n.Int64(); err != nil {
+		return time.Time{}, err
+	} else {
+		return time.Unix(secs, 0), nil
+	}
+}
+
+// Result of the getHealth RPC method.
+type RPCHealth struct {
+	Status                string
+	LatestLedger          uint32
+	OldestLedger          uint32
+	LedgerRetentionWindow uint32
+}
+
+// Check the health of the Soroban RPC server.
+func (net *StellarNet) RPCGetHealth(ctx context.Context) (
+	*RPCHealth, error) {
+	var ret RPCHealth
+	if err := net.RPCCall(ctx, "getHealth", nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Result of the getNetwork RPC method.
+type RPCNetwork struct {
+	FriendbotURL    string `json:"friendbotUrl"`
+	Passphrase      string
+	ProtocolVersion uint32
+}
+
+// Fetch the network passphrase and protocol version from the Soroban
+// RPC server.
+func (net *StellarNet) RPCGetNetwork(ctx context.Context) (
+	*RPCNetwork, error) {
+	var ret RPCNetwork
+	if err := net.RPCCall(ctx, "getNetwork", nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Result of the getLatestLedger RPC method.
+type RPCLatestLedger struct {
+	Id              stx.Hash
+	ProtocolVersion uint32
+	Sequence        uint32
+}
+
+func (r *RPCLatestLedger) UnmarshalJSON(data []byte) error {
+	var j struct {
+		Id              string
+		ProtocolVersion uint32
+		Sequence        uint32
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	} else if _, err = fmt.Sscanf(j.Id, "%v",
+		stx.XDR_Hash(&r.Id)); err != nil {
+		return err
+	}
+	r.ProtocolVersion = j.ProtocolVersion
+	r.Sequence = j.Sequence
+	return nil
+}
+
+// Fetch the latest ledger known to the Soroban RPC server.
+func (net *StellarNet) RPCGetLatestLedger(ctx context.Context) (
+	*RPCLatestLedger, error) {
+	var ret RPCLatestLedger
+	if err := net.RPCCall(ctx, "getLatestLedger", nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// A ledger entry returned by the getLedgerEntries RPC method.
+// LiveUntilLedgerSeq is 0 for entries without a time to live.
+type RPCLedgerEntry struct {
+	Key                   stx.LedgerKey
+	Data                  stx.XdrAnon_LedgerEntry_Data
+	LastModifiedLedgerSeq uint32
+	LiveUntilLedgerSeq    uint32
+}
+
+func (r *RPCLedgerEntry) UnmarshalJSON(data []byte) error {
+	j := struct {
+		Key                   jsonXdr
+		Xdr                   jsonXdr
+		LastModifiedLedgerSeq uint32
+		LiveUntilLedgerSeq    uint32
+	}{
+		Key: jsonXdr{&r.Key},
+		Xdr: jsonXdr{&r.Data},
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	r.LastModifiedLedgerSeq = j.LastModifiedLedgerSeq
+	r.LiveUntilLedgerSeq = j.LiveUntilLedgerSeq
+	return nil
+}
+
+// Result of the getLedgerEntries RPC method.
+type RPCLedgerEntries struct {
+	Entries      []RPCLedgerEntry
+	LatestLedger uint32
+}
+
+// Fetch ledger entries from the Soroban RPC server.  Entries that do
+// not exist are omitted from the result.
+func (net *StellarNet) RPCGetLedgerEntries(ctx context.Context,
+	keys ...stx.LedgerKey) (*RPCLedgerEntries, error) {
+	params := struct {
+		Keys []string `json:"keys"`
+	}{make([]string, len(keys))}
+	for i := range keys {
+		params.Keys[i] = stcdetail.XdrToBase64(&keys[i])
+	}
+	var ret RPCLedgerEntries
+	if err := net.RPCCall(ctx, "getLedgerEntries", params,
+		&ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// The result of simulating one host function invocation.
+type RPCHostFunctionResult struct {
+	// Authorizations required to invoke the host function
+	Auth []stx.SorobanAuthorizationEntry
+	// Return value of the host function
+	Retval stx.SCVal
+}
+
+// Returned by simulation when archived ledger entries must be
+// restored before a transaction can execute.
+type RPCRestorePreamble struct {
+	TransactionData stx.SorobanTransactionData
+	MinResourceFee  int64
+}
+
+// Result of the simulateTransaction RPC method.
+type RPCSimulateResult struct {
+	TransactionData stx.SorobanTransactionData
+	MinResourceFee  int64
+	Events          []stx.DiagnosticEvent
+	Results         []RPCHostFunctionResult
+	Cost            struct {
+		CpuInsns uint64 `json:",string"`
+		MemBytes uint64 `json:",string"`
+	}
+	RestorePreamble *RPCRestorePreamble
+	Error           string
+	LatestLedger    uint32
+}
+
+func (r *RPCSimulateResult) UnmarshalJSON(data []byte) error {
+	var j struct {
+		TransactionData jsonXdr
+		MinResourceFee  json.Number
+		Events          []string
+		Results         []struct {
+			Auth []string
+			Xdr  string
+		}
+		Cost            json.RawMessage
+		RestorePreamble *struct {
+			TransactionData string
+			MinResourceFee  json.Number
+		}
+		Error        string
+		LatestLedger uint32
+	}
+	j.TransactionData = jsonXdr{&r.TransactionData}
+	var err error
+	if err = json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	r.Events = make([]stx.DiagnosticEvent, len(j.Events))
+	if err = xdrsFromBase64(j.Events, func(i int) xdr.XdrType {
+		return &r.Events[i]
+	}); err != nil {
+		return err
+	} else if j.Cost != nil {
+		if err = json.Unmarshal(j.Cost, &r.Cost); err != nil {
+			return err
+		}
+	}
+	if j.MinResourceFee != "" {
+		if r.MinResourceFee, err = j.MinResourceFee.Int64(); err != nil {
+			return err
+		}
+	}
+	r.Results = make([]RPCHostFunctionResult, len(j.Results))
+	for i := range j.Results {
+		res := &r.Results[i]
+		res.Auth = make([]stx.SorobanAuthorizationEntry,
+			len(j.Results[i].Auth))
+		if err = xdrsFromBase64(j.Results[i].Auth, func(i int) xdr.XdrType {
+			return &res.Auth[i]
+		}); err != nil {
+			return err
+		} else if err = stcdetail.XdrFromBase64(&res.Retval,
+			j.Results[i].Xdr); err != nil {
+			return err
+		}
+	}
+	if p := j.RestorePreamble; p != nil {
+		r.RestorePreamble = &RPCRestorePreamble{}
+		if err = stcdetail.XdrFromBase64(
+			&r.RestorePreamble.TransactionData,
+			p.TransactionData); err != nil {
+			return err
+		} else if r.RestorePreamble.MinResourceFee, err =
+			p.MinResourceFee.Int64(); err != nil {
+			return err
+		}
+	}
+	r.Error = j.Error
+	r.LatestLedger = j.LatestLedger
+	return nil
+}
+
+// Simulate a transaction containing an InvokeHostFunction,
+// ExtendFootprintTTL, or RestoreFootprint operation, to learn its
+// footprint, resource usage, and required authorizations.  If the
+// simulation fails, returns the result and a SimulationError.
+func (net *StellarNet) RPCSimulateTransaction(ctx context.Context,
+	e *TransactionEnvelope) (*RPCSimulateResult, error) {
+	params := struct {
+		Transaction string `json:"transaction"`
+	}{stcdetail.XdrToBase64(e)}
+	var ret RPCSimulateResult
+	if err := net.RPCCall(ctx, "simulateTransaction", params,
+		&ret); err != nil {
+		return nil, err
+	} else if ret.Error != "" {
+		return &ret, SimulationError(ret.Error)
+	}
+	return &ret, nil
+}
+
+// Result of the sendTransaction RPC method.
+type RPCSendResult struct {
+	Status                AsyncTxStatus
+	Hash                  stx.Hash
+	LatestLedger          uint32
+	LatestLedgerCloseTime time.Time
+	DiagnosticEvents      []stx.DiagnosticEvent
+	// Set when Status is AsyncError
+	ErrorResult *TransactionResult
+}
+
+func (r *RPCSendResult) UnmarshalJSON(data []byte) error {
+	var j struct {
+		Status                string
+		Hash                  string
+		LatestLedger          uint32
+		LatestLedgerCloseTime json.RawMessage
+		ErrorResultXdr        string
+		DiagnosticEventsXdr   []string
+	}
+	var err error
+	var ok bool
+	if err = json.Unmarshal(data, &j); err != nil {
+		return err
+	} else if r.Status, ok = parseAsyncTxStatus(j.Status); !ok {
+		return rpcFailure(fmt.Sprintf("Unknown transaction status %q",
+			j.Status))
+	} else if _, err = fmt.Sscanf(j.Hash, "%v",
+		stx.XDR_Hash(&r.Hash)); err != nil {
+		return err
+	} else if r.LatestLedgerCloseTime, err = parseUnixTime(
+		j.LatestLedgerCloseTime); err != nil {
+		return err
+	}
+	r.DiagnosticEvents = make([]stx.DiagnosticEvent,
+		len(j.DiagnosticEventsXdr))
+	if err = xdrsFromBase64(j.DiagnosticEventsXdr, func(i int) xdr.XdrType {
+		return &r.DiagnosticEvents[i]
+	}); err != nil {
+		return err
+	}
+	if j.ErrorResultXdr != "" {
+		r.ErrorResult = &TransactionResult{}
+		if err = stcdetail.XdrFromBase64(r.ErrorResult,
+			j.ErrorResultXdr); err != nil {
+			return err
+		}
+	}
+	r.LatestLedger = j.LatestLedger
+	return nil
+}
+
+// Submit a transaction through the Soroban RPC server, without
+// waiting for it to be included in a ledger.  As with PostAsync, when
+// the status is AsyncError, the error is a TxFailure.
+func (net *StellarNet) RPCSendTransaction(ctx context.Context,
+	e *TransactionEnvelope) (*RPCSendResult, error) {
+	params := struct {
+		Transaction string `json:"transaction"`
+	}{stcdetail.XdrToBase64(e)}
+	var ret RPCSendResult
+	if err := net.RPCCall(ctx, "sendTransaction", params,
+		&ret); err != nil {
+		return nil, err
+	} else if ret.Status == AsyncError && ret.ErrorResult != nil {
+		return &ret, TxFailure{ret.ErrorResult}
+	}
+	return &ret, nil
+}
+
+// Result of the getTransaction RPC method.  Status is one of
+// "SUCCESS", "FAILED", or "NOT_FOUND".  The remaining fields are only
+// set when the transaction was found.
+type RPCTxResult struct {
+	Status           string
+	LatestLedger     uint32
+	Ledger           uint32
+	CreatedAt        time.Time
+	ApplicationOrder int
+	FeeBump          bool
+	Env              stx.TransactionEnvelope
+	Result           stx.TransactionResult
+	ResultMeta       stx.TransactionMeta
+}
+
+func (r *RPCTxResult) UnmarshalJSON(data []byte) error {
+	j := struct {
+		Status           string
+		LatestLedger     uint32
+		Ledger           uint32
+		CreatedAt        json.RawMessage
+		ApplicationOrder int
+		FeeBump          bool
+		EnvelopeXdr      jsonXdr
+		ResultXdr        jsonXdr
+		ResultMetaXdr    jsonXdr
+	}{
+		EnvelopeXdr:   jsonXdr{&r.Env},
+		ResultXdr:     jsonXdr{&r.Result},
+		ResultMetaXdr: jsonXdr{&r.ResultMeta},
+	}
+	var err error
+	if err = json.Unmarshal(data, &j); err != nil {
+		return err
+	} else if r.CreatedAt, err = parseUnixTime(j.CreatedAt); err != nil {
+		return err
+	}
+	r.Status = j.Status
+	r.LatestLedger = j.LatestLedger
+	r.Ledger = j.Ledger
+	r.ApplicationOrder = j.ApplicationOrder
+	r.FeeBump = j.FeeBump
+	return nil
+}
+
+// Look up a transaction by its hex-encoded hash through the Soroban
+// RPC server.  Unlike GetTxResult, a missing transaction is not an
+// error, but rather has Status "NOT_FOUND".
+func (net *StellarNet) RPCGetTransaction(ctx context.Context,
+	txid string) (*RPCTxResult, error) {
+	params := struct {
+		Hash string `json:"hash"`
+	}{txid}
+	var ret RPCTxResult
+	if err := net.RPCCall(ctx, "getTransaction", params, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Selects events returned by RPCGetEvents.  Type is "contract",
+// "system", or "diagnostic" (or empty for all types).  ContractIds
+// are contract strkeys.  Each element of Topics is a list of
+// base64-encoded SCVals (or "*" to match any value, or "**" to match
+// any remaining values).
+type RPCEventFilter struct {
+	Type        string     `json:"type,omitempty"`
+	ContractIds []string   `json:"contractIds,omitempty"`
+	Topics      [][]string `json:"topics,omitempty"`
+}
+
+// An event returned by the getEvents RPC method.
+type RPCEvent struct {
+	Type                     string
+	Ledger                   uint32
+	LedgerClosedAt           time.Time
+	ContractId               string
+	Id                       string
+	Topic                    []stx.SCVal
+	Value                    stx.SCVal
+	InSuccessfulContractCall bool
+	TxHash                   string
+}
+
+func (r *RPCEvent) UnmarshalJSON(data []byte) error {
+	j := struct {
+		Type                     string
+		Ledger                   uint32
+		LedgerClosedAt           string
+		ContractId               string
+		Id                       string
+		Topic                    []string
+		Value                    jsonXdr
+		InSuccessfulContractCall bool
+		TxHash                   string
+	}{
+		Value: jsonXdr{&r.Value},
+	}
+	var err error
+	if err = json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	r.Topic = make([]stx.SCVal, len(j.Topic))
+	if err = xdrsFromBase64(j.Topic, func(i int) xdr.XdrType {
+		return &r.Topic[i]
+	}); err != nil {
+		return err
+	} else if j.LedgerClosedAt != "" {
+		if r.LedgerClosedAt, err = time.Parse(time.RFC3339,
+			j.LedgerClosedAt); err != nil {
+			return err
+		}
+	}
+	r.Type = j.Type
+	r.Ledger = j.Ledger
+	r.ContractId = j.ContractId
+	r.Id = j.Id
+	r.InSuccessfulContractCall = j.InSuccessfulContractCall
+	r.TxHash = j.TxHash
+	return nil
+}
+
+// Result of the getEvents RPC method.  Pass Cursor to a subsequent
+// call of RPCGetEvents to continue where this one left off.
+type RPCEvents struct {
+	Events       []RPCEvent
+	LatestLedger uint32
+	Cursor       string
+}
+
+// Fetch contract events matching any of filters, starting at
+// startLedger, or (if cursor is non-empty) after the position
+// indicated by cursor.  limit bounds the number of events returned
+// (0 means the server default).
+func (net *StellarNet) RPCGetEvents(ctx context.Context,
+	startLedger uint32, cursor string, limit uint,
+	filters ...RPCEventFilter) (*RPCEvents, error) {
+	type pagination struct {
+		Cursor string `json:"cursor,omitempty"`
+		Limit  uint   `json:"limit,omitempty"`
+	}
+	params := struct {
+		StartLedger uint32           `json:"startLedger,omitempty"`
+		Filters     []RPCEventFilter `json:"filters"`
+		Pagination  *pagination      `json:"pagination,omitempty"`
+	}{
+		Filters: filters,
+	}
+	if params.Filters == nil {
+		params.Filters = []RPCEventFilter{}
+	}
+	if cursor == "" {
+		params.StartLedger = startLedger
+	}
+	if cursor != "" || limit != 0 {
+		params.Pagination = &pagination{cursor, limit}
+	}
+	var ret RPCEvents
+	if err := net.RPCCall(ctx, "getEvents", params, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
@@ -0,0 +1,298 @@
+package stc
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"time"
+)
+
+// Lifetime of a SEP-10 challenge transaction if none is specified.
+const DefaultChallengeTimeout = 15 * time.Minute
+
+// How far in the future a challenge's minimum time may be, to allow
+// for clock skew between the client and the server.
+const challengeGracePeriod = 5 * time.Minute
+
+// Error returned when a SEP-10 challenge transaction is malformed or
+// insufficiently signed.
+type ChallengeError string
+
+func (e ChallengeError) Error() string {
+	return "invalid challenge: " + string(e)
+}
+
+// The contents of a SEP-10 Web Authentication challenge transaction.
+// See StellarNet.NewChallenge and StellarNet.ReadChallenge.
+type Challenge struct {
+	// The account the client is proving it controls.  May be a
+	// muxed (M...) account.
+	Client MuxedAccount
+
+	// Optional memo ID identifying a user of a shared account.  Must
+	// be nil if Client is a muxed account.
+	Memo *uint64
+
+	// Home domain of the server, which is the first operation's data
+	// name with " auth" removed.
+	HomeDomain string
+
+	// Domain of the server's web authentication endpoint.
+	WebAuthDomain string
+
+	// Optional domain of the client application, which must then
+	// sign the challenge with the key ClientDomainAccount.
+	ClientDomain        string
+	ClientDomainAccount *AccountID
+}
+
+/*
+Build a SEP-10 Web Authentication challenge transaction, signed by the
+server.  The transaction has source account server and sequence number
+0, so it can never be executed, and time bounds from now until timeout
+from now (DefaultChallengeTimeout if timeout is 0).  Its first
+operation is a ManageData operation with source account ch.Client,
+name ch.HomeDomain + " auth", and a random 48-byte base64-encoded
+nonce as value.  This is followed by a "web_auth_domain" ManageData
+operation with the server as source, and, if ch.ClientDomain is set,
+a "client_domain" operation with source ch.ClientDomainAccount.
+*/
+func (net *StellarNet) NewChallenge(server stcdetail.PrivateKeyInterface,
+	ch *Challenge, timeout time.Duration) (*TransactionEnvelope, error) {
+	switch {
+	case ch.HomeDomain == "" || len(ch.HomeDomain)+len(" auth") > 64:
+		return nil, ChallengeError("invalid home domain")
+	case ch.WebAuthDomain == "" || len(ch.WebAuthDomain) > 64:
+		return nil, ChallengeError("invalid web auth domain")
+	case len(ch.ClientDomain) > 64 ||
+		(ch.ClientDomain == "") != (ch.ClientDomainAccount == nil):
+		return nil, ChallengeError(
+			"client domain requires a client domain account")
+	case ch.Memo != nil && ch.Client.Type != stx.KEY_TYPE_ED25519:
+		return nil, ChallengeError("memo not allowed with muxed account")
+	}
+	if timeout <= 0 {
+		timeout = DefaultChallengeTimeout
+	}
+
+	nonce := make([]byte, 48)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	value := []byte(base64.StdEncoding.EncodeToString(nonce))
+	webAuthDomain := []byte(ch.WebAuthDomain)
+	serverID := server.Public()
+
+	e := NewTransactionEnvelope()
+	e.SetSourceAccount(serverID)
+	now := time.Now()
+	e.V1().Tx.Cond.Type = stx.PRECOND_TIME
+	*e.V1().Tx.Cond.TimeBounds() = stx.TimeBounds{
+		MinTime: uint64(now.Unix()),
+		MaxTime: uint64(now.Add(timeout).Unix()),
+	}
+	if ch.Memo != nil {
+		e.V1().Tx.Memo.Type = stx.MEMO_ID
+		*e.V1().Tx.Memo.Id() = *ch.Memo
+	}
+	client := ch.Client
+	e.Append(&client, ManageData{
+		DataName:  ch.HomeDomain + " auth",
+		DataValue: &value,
+	})
+	e.Append(serverID.ToMuxedAccount(), ManageData{
+		DataName:  "web_auth_domain",
+		DataValue: &webAuthDomain,
+	})
+	if ch.ClientDomain != "" {
+		clientDomain := []byte(ch.ClientDomain)
+		e.Append(ch.ClientDomainAccount.ToMuxedAccount(), ManageData{
+			DataName:  "client_domain",
+			DataValue: &clientDomain,
+		})
+	}
+	e.SetFee(100)
+	if err := net.SignTx(server, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+/*
+Parse and check the structure of a SEP-10 challenge transaction, as a
+server should do before verifying the client's signatures (see
+VerifyChallenge).  Checks that the transaction is from server, has
+sequence number 0, is within its time bounds, consists only of
+ManageData operations whose first names one of homeDomains and has a
+64-byte nonce, has a "web_auth_domain" operation matching
+webAuthDomain if it has one, and is signed by server.  Other
+operations must have the server as source account, except for
+"client_domain".  Does not check any signatures other than the
+server's.
+*/
+func (net *StellarNet) ReadChallenge(e *TransactionEnvelope, server AccountID,
+	webAuthDomain string, homeDomains ...string) (*Challenge, error) {
+	if e.Type != stx.ENVELOPE_TYPE_TX {
+		return nil, ChallengeError("not a V1 transaction")
+	}
+	tx := &e.V1().Tx
+	if tx.SourceAccount.String() != server.String() {
+		return nil, ChallengeError("source account is not the server")
+	} else if tx.SeqNum != 0 {
+		return nil, ChallengeError("sequence number is not 0")
+	}
+
+	tb := e.TimeBounds()
+	now := time.Now()
+	if tb == nil || tb.MaxTime == 0 {
+		return nil, ChallengeError("no time bounds")
+	} else if now.Add(challengeGracePeriod).Unix() < int64(tb.MinTime) ||
+		now.Unix() > int64(tb.MaxTime) {
+		return nil, ChallengeError("expired or not yet valid")
+	}
+
+	if len(tx.Operations) == 0 {
+		return nil, ChallengeError("no operations")
+	}
+	var ret Challenge
+	for i := range tx.Operations {
+		op := &tx.Operations[i]
+		if op.Body.Type != stx.MANAGE_DATA {
+			return nil, ChallengeError(fmt.Sprintf(
+				"operation %d is not ManageData", i))
+		} else if op.SourceAccount == nil {
+			return nil, ChallengeError(fmt.Sprintf(
+				"operation %d has no source account", i))
+		}
+		md := op.Body.ManageDataOp()
+		var value []byte
+		if md.DataValue != nil {
+			value = *md.DataValue
+		}
+		switch {
+		case i == 0:
+			ret.Client = *op.SourceAccount
+			for _, d := range homeDomains {
+				if md.DataName == d+" auth" {
+					ret.HomeDomain = d
+				}
+			}
+			if ret.HomeDomain == "" {
+				return nil, ChallengeError(fmt.Sprintf(
+					"unexpected home domain operation %q", md.DataName))
+			} else if len(value) != 64 {
+				return nil, ChallengeError("nonce must be 64 bytes")
+			} else if n, err := base64.StdEncoding.DecodeString(
+				string(value)); err != nil || len(n) != 48 {
+				return nil, ChallengeError("invalid nonce")
+			}
+		case md.DataName == "client_domain":
+			acct, _ := DemuxAcct(op.SourceAccount)
+			ret.ClientDomain = string(value)
+			ret.ClientDomainAccount = acct
+		case op.SourceAccount.String() != server.String():
+			return nil, ChallengeError(fmt.Sprintf(
+				"operation %d source account is not the server", i))
+		case md.DataName == "web_auth_domain":
+			if string(value) != webAuthDomain {
+				return nil, ChallengeError(fmt.Sprintf(
+					"web auth domain %q does not match %q",
+					value, webAuthDomain))
+			}
+			ret.WebAuthDomain = webAuthDomain
+		}
+	}
+
+	switch tx.Memo.Type {
+	case stx.MEMO_NONE:
+	case stx.MEMO_ID:
+		if ret.Client.Type != stx.KEY_TYPE_ED25519 {
+			return nil, ChallengeError("memo not allowed with muxed account")
+		}
+		ret.Memo = new(uint64)
+		*ret.Memo = *tx.Memo.Id()
+	default:
+		return nil, ChallengeError("memo must be of type MEMO_ID")
+	}
+
+	serverKey := server.ToSignerKey()
+	for _, sig := range e.V1().Signatures {
+		if net.VerifySig(&serverKey, e, sig.Signature) {
+			return &ret, nil
+		}
+	}
+	return nil, ChallengeError("not signed by server")
+}
+
+/*
+Read a SEP-10 challenge transaction with ReadChallenge and verify the
+client's signatures on it.  signers should be the client account's
+signers and threshold the weight they must reach, usually the
+account's medium threshold (both from HorizonAccountEntry, though
+this function does not access the network).  If the client account
+does not exist, pass only its master key with weight 1.  Only
+ed25519 signers are considered.  Every signature on the challenge
+must be from the server, one of signers, or the client domain
+account, which must have signed if the challenge has a client_domain
+operation.
+*/
+func (net *StellarNet) VerifyChallenge(e *TransactionEnvelope,
+	server AccountID, webAuthDomain string, homeDomains []string,
+	signers []HorizonSigner, threshold uint32) (*Challenge, error) {
+	ch, err := net.ReadChallenge(e, server, webAuthDomain, homeDomains...)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := SignerCache{}
+	weights := make(map[string]uint32)
+	for i := range signers {
+		if signers[i].Key.Type == stx.SIGNER_KEY_TYPE_ED25519 &&
+			signers[i].Weight > 0 {
+			key := signers[i].Key.String()
+			cache.Add(key, "")
+			weights[key] += signers[i].Weight
+		}
+	}
+	cache.Add(server.String(), "")
+	var clientDomainKey string
+	if ch.ClientDomainAccount != nil {
+		clientDomainKey = ch.ClientDomainAccount.String()
+		cache.Add(clientDomainKey, "")
+	}
+
+	seen := make(map[string]bool)
+	var weight uint32
+	clientSigned, clientDomainSigned := false, false
+	for i, sig := range *e.Signatures() {
+		ski := cache.Lookup(net.GetNetworkId(), e.TransactionEnvelope, &sig)
+		if ski == nil {
+			return nil, ChallengeError(fmt.Sprintf(
+				"signature %d is not from the server or a client signer", i))
+		}
+		key := ski.Key.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == clientDomainKey {
+			clientDomainSigned = true
+		}
+		if w, ok := weights[key]; ok {
+			weight += w
+			clientSigned = true
+		}
+	}
+	if !clientSigned {
+		return nil, ChallengeError("not signed by client")
+	} else if ch.ClientDomainAccount != nil && !clientDomainSigned {
+		return nil, ChallengeError("not signed by client domain account")
+	} else if weight < threshold {
+		return nil, ChallengeError(fmt.Sprintf(
+			"client signature weight %d below threshold %d",
+			weight, threshold))
+	}
+	return ch, nil
+}
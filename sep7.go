@@ -0,0 +1,315 @@
+package stc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const sep7Scheme = "web+stellar:"
+
+// Network assumed by a SEP-7 URI without a network_passphrase.
+const sep7DefaultNetwork = "Public Global Stellar Network ; September 2015"
+
+// A SEP-7 URI, which asks a wallet to sign a transaction ("tx") or
+// make a payment ("pay").  Parse one with ParseStellarURI and render
+// it with String.
+type StellarURI struct {
+	// "tx" or "pay".
+	Operation string
+
+	// Fields of the tx operation.  Chain is a previous URI that
+	// caused this one to be generated.
+	Tx      *TransactionEnvelope
+	Replace string
+	Pubkey  string
+	Chain   string
+
+	// Fields of the pay operation.  A nil Amount lets the user choose
+	// the amount, and a nil Asset means the native asset.
+	Destination MuxedAccount
+	Amount      *Amount
+	Asset       *stx.Asset
+	Memo        stx.Memo
+
+	// URL (without the "url:" prefix) to which the wallet should POST
+	// the signed transaction instead of submitting it.
+	Callback string
+
+	// Message to show the user (at most 300 characters).
+	Msg string
+
+	// Network passphrase, or "" for the public network.
+	NetworkPassphrase string
+
+	// Domain of the requester, whose stellar.toml file publishes the
+	// URI_REQUEST_SIGNING_KEY that produced Signature.
+	OriginDomain string
+	Signature    []byte
+
+	// For a parsed URI, the exact text covered by Signature.
+	unsigned string
+}
+
+// Create a SEP-7 URI asking a wallet to sign transaction e on this
+// network.
+func (net *StellarNet) TxURI(e *TransactionEnvelope) *StellarURI {
+	ret := &StellarURI{Operation: "tx", Tx: e}
+	if id := net.GetNetworkId(); id != sep7DefaultNetwork {
+		ret.NetworkPassphrase = id
+	}
+	return ret
+}
+
+// Returns the passphrase of the network the URI is for.
+func (u *StellarURI) Network() string {
+	if u.NetworkPassphrase == "" {
+		return sep7DefaultNetwork
+	}
+	return u.NetworkPassphrase
+}
+
+func uriEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func (u *StellarURI) encode(withSig bool) string {
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "%s%s", sep7Scheme, u.Operation)
+	sep := "?"
+	add := func(key, val string) {
+		if val != "" {
+			fmt.Fprintf(out, "%s%s=%s", sep, key, uriEscape(val))
+			sep = "&"
+		}
+	}
+	switch u.Operation {
+	case "tx":
+		if u.Tx != nil {
+			add("xdr", TxToBase64(u.Tx))
+		}
+		add("replace", u.Replace)
+		if u.Callback != "" {
+			add("callback", "url:"+u.Callback)
+		}
+		add("pubkey", u.Pubkey)
+		add("chain", u.Chain)
+	case "pay":
+		add("destination", u.Destination.String())
+		if u.Amount != nil {
+			amount, _ := u.Amount.MarshalText()
+			add("amount", strings.TrimSuffix(
+				strings.TrimRight(string(amount), "0"), "."))
+		}
+		if u.Asset != nil && u.Asset.Type != stx.ASSET_TYPE_NATIVE {
+			asset := u.Asset.String()
+			i := strings.LastIndexByte(asset, ':')
+			add("asset_code", asset[:i])
+			add("asset_issuer", asset[i+1:])
+		}
+		switch u.Memo.Type {
+		case stx.MEMO_TEXT:
+			add("memo", *u.Memo.Text())
+		case stx.MEMO_ID:
+			add("memo", strconv.FormatUint(*u.Memo.Id(), 10))
+		case stx.MEMO_HASH:
+			add("memo", base64.StdEncoding.EncodeToString(u.Memo.Hash()[:]))
+		case stx.MEMO_RETURN:
+			add("memo", base64.StdEncoding.EncodeToString(u.Memo.RetHash()[:]))
+		}
+		if u.Memo.Type != stx.MEMO_NONE {
+			add("memo_type", u.Memo.Type.String())
+		}
+		if u.Callback != "" {
+			add("callback", "url:"+u.Callback)
+		}
+	}
+	add("msg", u.Msg)
+	add("network_passphrase", u.NetworkPassphrase)
+	add("origin_domain", u.OriginDomain)
+	if withSig && len(u.Signature) > 0 {
+		add("signature", base64.StdEncoding.EncodeToString(u.Signature))
+	}
+	return out.String()
+}
+
+// Renders the URI in web+stellar: format, with the signature as the
+// last parameter.
+func (u *StellarURI) String() string {
+	return u.encode(true)
+}
+
+func sep7Payload(uri string) []byte {
+	prefix := make([]byte, 36)
+	prefix[35] = 4
+	return append(append(prefix, "stellar.sep.7 - URI Scheme"...), uri...)
+}
+
+// Sign the URI with the URI_REQUEST_SIGNING_KEY of u.OriginDomain.
+// Set all other fields first, as the signature covers the whole URI.
+func (u *StellarURI) Sign(sk stcdetail.PrivateKeyInterface) error {
+	u.Signature, u.unsigned = nil, ""
+	sig, err := sk.Sign(sep7Payload(u.encode(false)))
+	if err != nil {
+		return err
+	}
+	u.Signature = sig
+	return nil
+}
+
+// Returns true if the URI carries a valid signature by pk, which
+// should be the URI_REQUEST_SIGNING_KEY published in the stellar.toml
+// file of u.OriginDomain.  For a parsed URI, the signature is checked
+// against the URI exactly as it was parsed.
+func (u *StellarURI) Verify(pk PublicKey) bool {
+	if len(u.Signature) == 0 {
+		return false
+	}
+	text := u.unsigned
+	if text == "" {
+		text = u.encode(false)
+	}
+	return stcdetail.Verify(&pk, sep7Payload(text), u.Signature)
+}
+
+/*
+Parse a SEP-7 URI such as
+
+	web+stellar:tx?xdr=AAAA...&callback=url%3Ahttps%3A%2F%2Fexample.com
+
+or
+
+	web+stellar:pay?destination=GBD3...&amount=12.5&memo=rent&memo_type=MEMO_TEXT
+
+The transaction in a tx URI is decoded with TxFromBase64.
+*/
+func ParseStellarURI(s string) (*StellarURI, error) {
+	if !strings.HasPrefix(s, sep7Scheme) {
+		return nil, fmt.Errorf("URI does not start with %s", sep7Scheme)
+	}
+	op, query := s[len(sep7Scheme):], ""
+	if i := strings.IndexByte(op, '?'); i >= 0 {
+		op, query = op[:i], op[i+1:]
+	}
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	ret := &StellarURI{
+		Operation:         op,
+		Msg:               vals.Get("msg"),
+		NetworkPassphrase: vals.Get("network_passphrase"),
+		OriginDomain:      vals.Get("origin_domain"),
+	}
+	if cb := vals.Get("callback"); cb != "" {
+		if !strings.HasPrefix(cb, "url:") {
+			return nil, fmt.Errorf("callback must start with \"url:\"")
+		}
+		ret.Callback = cb[4:]
+	}
+	if sig := vals.Get("signature"); sig != "" {
+		i := strings.LastIndex(s, "&signature=")
+		if i < 0 || strings.ContainsRune(s[i+1:], '&') {
+			return nil, fmt.Errorf("signature must be the last parameter")
+		} else if ret.Signature, err =
+			base64.StdEncoding.DecodeString(sig); err != nil {
+			return nil, fmt.Errorf("invalid signature: %w", err)
+		}
+		ret.unsigned = s[:i]
+	}
+
+	switch op {
+	case "tx":
+		if ret.Tx, err = TxFromBase64(vals.Get("xdr")); err != nil {
+			return nil, fmt.Errorf("invalid xdr: %w", err)
+		}
+		ret.Replace = vals.Get("replace")
+		ret.Pubkey = vals.Get("pubkey")
+		ret.Chain = vals.Get("chain")
+	case "pay":
+		if _, err = fmt.Sscan(vals.Get("destination"),
+			&ret.Destination); err != nil {
+			return nil, fmt.Errorf("invalid destination: %w", err)
+		}
+		if v := vals.Get("amount"); v != "" {
+			ret.Amount = new(Amount)
+			if err = ret.Amount.UnmarshalText([]byte(v)); err != nil {
+				return nil, fmt.Errorf("invalid amount: %w", err)
+			}
+		}
+		if code := vals.Get("asset_code"); code != "" {
+			ret.Asset = new(stx.Asset)
+			if _, err = fmt.Sscan(code+":"+vals.Get("asset_issuer"),
+				ret.Asset); err != nil {
+				return nil, fmt.Errorf("invalid asset: %w", err)
+			}
+		}
+		if err = ret.parseMemo(vals.Get("memo"),
+			vals.Get("memo_type")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown SEP-7 operation %q", op)
+	}
+	return ret, nil
+}
+
+func (u *StellarURI) parseMemo(memo, memoType string) error {
+	if memo == "" {
+		return nil
+	} else if memoType == "" {
+		memoType = "MEMO_TEXT"
+	}
+	var err error
+	switch memoType {
+	case "MEMO_TEXT":
+		u.Memo.Type = stx.MEMO_TEXT
+		*u.Memo.Text() = memo
+	case "MEMO_ID":
+		u.Memo.Type = stx.MEMO_ID
+		*u.Memo.Id(), err = strconv.ParseUint(memo, 10, 64)
+	case "MEMO_HASH", "MEMO_RETURN":
+		var h []byte
+		h, err = base64.StdEncoding.DecodeString(memo)
+		if err == nil && len(h) != len(stx.Hash{}) {
+			err = fmt.Errorf("hash must be %d bytes", len(stx.Hash{}))
+		}
+		if memoType == "MEMO_HASH" {
+			u.Memo.Type = stx.MEMO_HASH
+			copy(u.Memo.Hash()[:], h)
+		} else {
+			u.Memo.Type = stx.MEMO_RETURN
+			copy(u.Memo.RetHash()[:], h)
+		}
+	default:
+		err = fmt.Errorf("unknown memo_type %q", memoType)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid memo: %w", err)
+	}
+	return nil
+}
+
+// Returns the transaction a URI asks the user to sign.  For a pay
+// URI, this is a new transaction containing just the payment (and
+// memo), with no source account or sequence number.
+func (u *StellarURI) Envelope() *TransactionEnvelope {
+	if u.Operation != "pay" {
+		return u.Tx
+	}
+	e := NewTransactionEnvelope()
+	e.V1().Tx.Memo = u.Memo
+	p := Payment{Destination: u.Destination, Asset: NativeAsset()}
+	if u.Asset != nil {
+		p.Asset = *u.Asset
+	}
+	if u.Amount != nil {
+		p.Amount = int64(*u.Amount)
+	}
+	e.Append(nil, p)
+	return e
+}
@@ -0,0 +1,262 @@
+package stc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long SequenceTracker waits for another process to release the
+// lock on its file before giving up.
+const seqLockTimeout = 5 * time.Second
+
+// Hands out sequence numbers for transactions from one or more source
+// accounts, so that many transactions can be built concurrently
+// without each one querying horizon (and getting the same number).
+// The first time it sees an account, a SequenceTracker loads the
+// account's sequence number from horizon, and then it returns
+// increasing numbers from memory.  If Path is non-empty, the next
+// sequence number of each account is instead kept in that file, so
+// that multiple processes can share the same SequenceTracker state.
+// A SequenceTracker is safe for concurrent use.
+type SequenceTracker struct {
+	Net *StellarNet
+
+	// File in which to store sequence numbers, or "" to keep them only
+	// in memory.
+	Path string
+
+	mu      sync.Mutex
+	next    map[string]stx.SequenceNumber
+	loading map[string]chan struct{}
+}
+
+// Create a SequenceTracker for a network.  If persist is true,
+// sequence numbers are stored under ConfigPath() in a file named after
+// the network.
+func NewSequenceTracker(net *StellarNet, persist bool) *SequenceTracker {
+	ret := &SequenceTracker{Net: net}
+	if persist {
+		ret.Path = ConfigPath(net.Name + ".seq")
+	}
+	return ret
+}
+
+// The key for an account, which ignores any multiplexed ID since all
+// multiplexed accounts share one sequence number.
+func seqKey(acct stx.IsAccount) string {
+	return acct.ToMuxedAccount().ToSignerKey().String()
+}
+
+func parseSeqFile(contents []byte) (map[string]stx.SequenceNumber, error) {
+	ret := make(map[string]stx.SequenceNumber)
+	sc := bufio.NewScanner(bytes.NewReader(contents))
+	for lineno := 1; sc.Scan(); lineno++ {
+		var acct string
+		var seq stx.SequenceNumber
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		} else if _, err := fmt.Sscan(sc.Text(), &acct, &seq); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineno, err)
+		}
+		ret[acct] = seq
+	}
+	return ret, sc.Err()
+}
+
+// Lock st.Path and call fn on its contents, writing back the result if
+// fn succeeds.  Waits for other processes holding the lock.
+func (st *SequenceTracker) withFile(ctx context.Context,
+	fn func(map[string]stx.SequenceNumber) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	deadline := time.Now().Add(seqLockTimeout)
+	var lf stcdetail.LockedFile
+	for {
+		var err error
+		if lf, err = stcdetail.LockFile(st.Path, 0666); err == nil {
+			break
+		} else if !os.IsExist(err) || time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer lf.Abort()
+
+	contents, err := lf.ReadFile()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	seqs, err := parseSeqFile(contents)
+	if err != nil {
+		return fmt.Errorf("%s: %s", st.Path, err)
+	}
+	if err = fn(seqs); err != nil {
+		return err
+	}
+	accts := make([]string, 0, len(seqs))
+	for acct := range seqs {
+		accts = append(accts, acct)
+	}
+	sort.Strings(accts)
+	for _, acct := range accts {
+		fmt.Fprintf(lf, "%s %d\n", acct, seqs[acct])
+	}
+	return lf.Commit()
+}
+
+// Call fn on the tracker's sequence numbers while holding st.mu and,
+// if st.Path is set, the lock on the file.
+func (st *SequenceTracker) locked(ctx context.Context,
+	fn func(map[string]stx.SequenceNumber)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Path != "" {
+		return st.withFile(ctx, func(seqs map[string]stx.SequenceNumber) error {
+			fn(seqs)
+			return nil
+		})
+	}
+	if st.next == nil {
+		st.next = make(map[string]stx.SequenceNumber)
+	}
+	fn(st.next)
+	return nil
+}
+
+// Load the sequence number of key from horizon without holding any
+// locks, then store it unless the tracker has meanwhile learned of a
+// higher one.  If another goroutine is already loading key, just waits
+// for it to finish.
+func (st *SequenceTracker) load(ctx context.Context, key string) error {
+	st.mu.Lock()
+	if ch, ok := st.loading[key]; ok {
+		st.mu.Unlock()
+		if ctx == nil {
+			<-ch
+			return nil
+		}
+		select {
+		case <-ch:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if st.loading == nil {
+		st.loading = make(map[string]chan struct{})
+	}
+	ch := make(chan struct{})
+	st.loading[key] = ch
+	st.mu.Unlock()
+	defer func() {
+		st.mu.Lock()
+		delete(st.loading, key)
+		st.mu.Unlock()
+		close(ch)
+	}()
+
+	ae, err := st.Net.GetAccountEntryCtx(ctx, key)
+	if err != nil {
+		return err
+	}
+	return st.locked(ctx, func(seqs map[string]stx.SequenceNumber) {
+		if seq := ae.NextSeq(); seq > seqs[key] {
+			seqs[key] = seq
+		}
+	})
+}
+
+// Return the next sequence number to use for a transaction with
+// source account acct, loading the account from horizon if the
+// tracker does not yet know its sequence number.  Neither the
+// tracker nor its file is locked while waiting for horizon.  ctx may
+// be nil.
+func (st *SequenceTracker) Next(ctx context.Context,
+	acct stx.IsAccount) (stx.SequenceNumber, error) {
+	key := seqKey(acct)
+	for {
+		var ret stx.SequenceNumber
+		ok := false
+		err := st.locked(ctx, func(seqs map[string]stx.SequenceNumber) {
+			if ret, ok = seqs[key]; ok {
+				seqs[key]++
+			}
+		})
+		if err != nil || ok {
+			return ret, err
+		} else if err = st.load(ctx, key); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Set the SeqNum of a transaction to the next sequence number of its
+// source account.  ctx may be nil.
+func (st *SequenceTracker) SetSeqNum(ctx context.Context,
+	e *TransactionEnvelope) error {
+	var target *stx.SequenceNumber
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX:
+		target = &e.V1().Tx.SeqNum
+	case stx.ENVELOPE_TYPE_TX_V0:
+		target = &e.V0().Tx.SeqNum
+	default:
+		return fmt.Errorf("cannot set sequence number of %s", e.Type)
+	}
+	seq, err := st.Next(ctx, e.SourceAccount())
+	if err == nil {
+		*target = seq
+	}
+	return err
+}
+
+// Returns true if err is a TxFailure reporting a bad sequence number.
+func IsBadSeq(err error) bool {
+	f, ok := err.(TxFailure)
+	if !ok || f.TransactionResult == nil {
+		return false
+	}
+	switch f.Result.Code {
+	case stx.TxBAD_SEQ:
+		return true
+	case stx.TxFEE_BUMP_INNER_FAILED:
+		return f.Result.InnerResultPair().Result.Result.Code == stx.TxBAD_SEQ
+	}
+	return false
+}
+
+// Discard the tracker's sequence number for acct, so that the next
+// call to Next reloads it from horizon.
+func (st *SequenceTracker) Reset(ctx context.Context,
+	acct stx.IsAccount) error {
+	key := seqKey(acct)
+	return st.locked(ctx, func(seqs map[string]stx.SequenceNumber) {
+		delete(seqs, key)
+	})
+}
+
+// Call with the error from posting a transaction from source account
+// acct.  If the error shows the transaction had a bad sequence number
+// (see IsBadSeq), resets the account's sequence number (see Reset) and
+// returns true.  Otherwise, returns false.
+func (st *SequenceTracker) Resync(ctx context.Context, acct stx.IsAccount,
+	err error) bool {
+	if !IsBadSeq(err) {
+		return false
+	}
+	st.Reset(ctx, acct)
+	return true
+}
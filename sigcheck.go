@@ -0,0 +1,210 @@
+package stc
+
+import (
+	"context"
+	"fmt"
+	"github.com/xdrpp/stc/stx"
+	"strings"
+)
+
+// How well an account's signature requirements are met by the
+// signatures on a transaction.  See StellarNet.CheckSignatures.
+type SigStatus struct {
+	Account AccountID
+
+	// The highest threshold needed by the transaction or any of the
+	// account's operations (THRESHOLD_LOW, THRESHOLD_MED, or
+	// THRESHOLD_HIGH).
+	Level stx.ThresholdIndexes
+
+	// The value of that threshold for the account.  Since a
+	// transaction always needs at least one signature, a threshold
+	// of 0 is reported as 1.
+	Threshold uint32
+
+	// The total weight of the account's signers that have signed.
+	Weight uint32
+
+	// Signers with non-zero weight that have not signed.
+	Missing []HorizonSigner
+}
+
+// Returns true if the signatures meet the threshold.
+func (s *SigStatus) Ok() bool {
+	return s.Weight >= s.Threshold
+}
+
+func (s *SigStatus) String() string {
+	out := &strings.Builder{}
+	level := strings.ToLower(strings.TrimPrefix(s.Level.String(),
+		"THRESHOLD_"))
+	fmt.Fprintf(out, "%s: weight %d of %d needed (%s threshold)",
+		s.Account, s.Weight, s.Threshold, level)
+	if !s.Ok() {
+		for i := range s.Missing {
+			fmt.Fprintf(out, "\n  missing %s (weight %d)",
+				s.Missing[i].Key, s.Missing[i].Weight)
+		}
+	}
+	return out.String()
+}
+
+// Returns the threshold an operation needs from its source account.
+func opThreshold(op *stx.Operation) stx.ThresholdIndexes {
+	switch op.Body.Type {
+	case stx.ALLOW_TRUST, stx.SET_TRUST_LINE_FLAGS, stx.BUMP_SEQUENCE,
+		stx.CLAIM_CLAIMABLE_BALANCE, stx.INFLATION,
+		stx.EXTEND_FOOTPRINT_TTL, stx.RESTORE_FOOTPRINT:
+		return stx.THRESHOLD_LOW
+	case stx.ACCOUNT_MERGE:
+		return stx.THRESHOLD_HIGH
+	case stx.SET_OPTIONS:
+		so := op.Body.SetOptionsOp()
+		if so.MasterWeight != nil || so.LowThreshold != nil ||
+			so.MedThreshold != nil || so.HighThreshold != nil ||
+			so.Signer != nil {
+			return stx.THRESHOLD_HIGH
+		}
+	}
+	return stx.THRESHOLD_MED
+}
+
+// Returns the total weight of signers that have signed e, and the
+// signers that have not.
+func (net *StellarNet) signerWeight(e *TransactionEnvelope,
+	signers []HorizonSigner) (weight uint32, missing []HorizonSigner) {
+	sigs := *e.Signatures()
+signerloop:
+	for i := range signers {
+		s := &signers[i]
+		if s.Weight == 0 {
+			continue
+		} else if s.Key.Type == stx.SIGNER_KEY_TYPE_PRE_AUTH_TX {
+			if net.VerifySig(&s.Key, e, nil) {
+				weight += s.Weight
+				continue
+			}
+		} else {
+			for j := range sigs {
+				if net.VerifySig(&s.Key, e, sigs[j].Signature) {
+					weight += s.Weight
+					continue signerloop
+				}
+			}
+		}
+		missing = append(missing, *s)
+	}
+	return
+}
+
+/*
+Determine whether a transaction has enough signatures to be valid.
+Fetches the HorizonAccountEntry of the transaction's source account
+and of each operation's source account, determines the threshold each
+needs (low for the transaction source and for operations such as
+BumpSequence, high for AccountMerge and SetOptions operations that
+change signers or thresholds, and medium otherwise), and totals the
+weights of the account's signers whose signatures are present.
+Pre-auth transaction signers count if their hash matches the
+transaction.  An account that does not exist is assumed to have only
+its master key, with weight 1.  For a fee-bump transaction, checks the
+inner transaction and then the fee source.  ctx may be nil.
+*/
+func (net *StellarNet) CheckSignatures(ctx context.Context,
+	e *TransactionEnvelope) ([]SigStatus, error) {
+	var ret []SigStatus
+	var src *stx.MuxedAccount
+	var ops []stx.Operation
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		inner := &TransactionEnvelope{
+			TransactionEnvelope: &stx.TransactionEnvelope{
+				Type: stx.ENVELOPE_TYPE_TX,
+			},
+		}
+		*inner.V1() = *e.FeeBump().Tx.InnerTx.V1()
+		var err error
+		if ret, err = net.CheckSignatures(ctx, inner); err != nil {
+			return nil, err
+		}
+		src = &e.FeeBump().Tx.FeeSource
+	case stx.ENVELOPE_TYPE_TX, stx.ENVELOPE_TYPE_TX_V0:
+		src = e.SourceAccount()
+		ops = *e.Operations()
+	default:
+		return nil, fmt.Errorf("cannot check signatures of %s", e.Type)
+	}
+
+	var accounts []string
+	levels := make(map[string]stx.ThresholdIndexes)
+	need := func(acct stx.IsAccount, level stx.ThresholdIndexes) {
+		key := seqKey(acct)
+		if old, ok := levels[key]; !ok {
+			accounts = append(accounts, key)
+		} else if old > level {
+			return
+		}
+		levels[key] = level
+	}
+	need(src, stx.THRESHOLD_LOW)
+	for i := range ops {
+		if ops[i].SourceAccount != nil {
+			need(ops[i].SourceAccount, opThreshold(&ops[i]))
+		} else {
+			need(src, opThreshold(&ops[i]))
+		}
+	}
+
+	type result struct {
+		acct string
+		ae   *HorizonAccountEntry
+		err  error
+	}
+	c := make(chan result)
+	for _, acct := range accounts {
+		go func(acct string) {
+			ae, err := net.GetAccountEntryCtx(ctx, acct)
+			c <- result{acct, ae, err}
+		}(acct)
+	}
+	entries := make(map[string]*HorizonAccountEntry)
+	var err error
+	for range accounts {
+		r := <-c
+		if r.err != nil && isNotFound(r.err) {
+			var id AccountID
+			fmt.Sscan(r.acct, &id)
+			r.ae, r.err = &HorizonAccountEntry{
+				Signers: []HorizonSigner{{Key: id.ToSignerKey(), Weight: 1}},
+			}, nil
+		}
+		if r.err != nil {
+			err = r.err
+		} else {
+			entries[r.acct] = r.ae
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, acct := range accounts {
+		ae := entries[acct]
+		st := SigStatus{Level: levels[acct]}
+		fmt.Sscan(acct, &st.Account)
+		switch st.Level {
+		case stx.THRESHOLD_LOW:
+			st.Threshold = uint32(ae.Thresholds.Low_threshold)
+		case stx.THRESHOLD_MED:
+			st.Threshold = uint32(ae.Thresholds.Med_threshold)
+		case stx.THRESHOLD_HIGH:
+			st.Threshold = uint32(ae.Thresholds.High_threshold)
+		}
+		if st.Threshold == 0 {
+			st.Threshold = 1
+		}
+		st.Weight, st.Missing = net.signerWeight(e, ae.Signers)
+		ret = append(ret, st)
+	}
+	return ret, nil
+}
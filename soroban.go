@@ -0,0 +1,244 @@
+package stc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"math"
+	"sort"
+)
+
+type SCVal = stx.SCVal
+
+// A string that converts to an SCVal of type SCV_SYMBOL rather than
+// SCV_STRING.
+type Symbol = stcdetail.Symbol
+
+// Error converting between a Go value and an SCVal.
+type SCValError = stcdetail.SCValError
+
+// Converts a Go value to an SCVal.  See stcdetail.ToSCVal for the
+// mapping between Go types and SCVal types, including the scval
+// struct tags.
+func ToSCVal(v interface{}) (SCVal, error) {
+	return stcdetail.ToSCVal(v)
+}
+
+// Converts an SCVal to a Go value, storing it in out, which must be a
+// non-nil pointer.  This is the inverse of ToSCVal.
+func FromSCVal(val *SCVal, out interface{}) error {
+	return stcdetail.FromSCVal(val, out)
+}
+
+var ErrNotSoroban = errors.New("Soroban transactions must contain " +
+	"exactly one InvokeHostFunction, ExtendFootprintTTL, " +
+	"or RestoreFootprint operation")
+
+var ErrFeeTooLarge = errors.New("Transaction fee exceeds the maximum")
+
+var ErrNotAddressCredentials = errors.New(
+	"Authorization entry does not use address credentials")
+
+// Returned by PrepareSoroban when some of the ledger entries a
+// transaction needs have been archived.  The entries must first be
+// restored by a transaction containing a RestoreFootprint operation
+// and the TransactionData in the RPCRestorePreamble.
+type RestoreNeededError struct {
+	*RPCRestorePreamble
+}
+
+func (e RestoreNeededError) Error() string {
+	return "Archived ledger entries must be restored first"
+}
+
+// Returns the single Soroban operation of a transaction, or nil if e
+// is not a Soroban transaction.
+func sorobanOp(e *TransactionEnvelope) *stx.XdrAnon_Operation_Body {
+	if e.Type != stx.ENVELOPE_TYPE_TX ||
+		len(e.V1().Tx.Operations) != 1 {
+		return nil
+	}
+	op := &e.V1().Tx.Operations[0].Body
+	switch op.Type {
+	case stx.INVOKE_HOST_FUNCTION, stx.EXTEND_FOOTPRINT_TTL,
+		stx.RESTORE_FOOTPRINT:
+		return op
+	}
+	return nil
+}
+
+// Simulate a Soroban transaction through the RPC server and fill in
+// the footprint, resource limits, and resource fee that the
+// simulation returns.  For InvokeHostFunction operations that do not
+// already have authorization entries, also fills in the
+// authorizations the simulation says are required (which may still
+// need to be signed).  Sets the transaction fee to the inclusion fee
+// plus the resource fee, where the inclusion fee is whatever part of
+// the existing fee is not a previous resource fee.  Since the
+// transaction changes, any existing signatures become invalid.  ctx
+// may be nil.
+func (net *StellarNet) PrepareSoroban(ctx context.Context,
+	e *TransactionEnvelope) error {
+	op := sorobanOp(e)
+	if op == nil {
+		return ErrNotSoroban
+	}
+	tx := &e.V1().Tx
+	inclusionFee := int64(tx.Fee)
+	if tx.Ext.V == 1 {
+		inclusionFee -= int64(tx.Ext.SorobanData().ResourceFee)
+		if inclusionFee < 0 {
+			inclusionFee = 0
+		}
+	}
+
+	sim, err := net.RPCSimulateTransaction(ctx, e)
+	if err != nil {
+		return err
+	} else if sim.RestorePreamble != nil {
+		return RestoreNeededError{sim.RestorePreamble}
+	}
+
+	fee := inclusionFee + sim.MinResourceFee
+	if fee > math.MaxUint32 {
+		return ErrFeeTooLarge
+	}
+	tx.Fee = uint32(fee)
+	tx.Ext.V = 1
+	*tx.Ext.SorobanData() = sim.TransactionData
+	tx.Ext.SorobanData().ResourceFee = sim.MinResourceFee
+	if op.Type == stx.INVOKE_HOST_FUNCTION &&
+		len(op.InvokeHostFunctionOp().Auth) == 0 && len(sim.Results) > 0 {
+		op.InvokeHostFunctionOp().Auth = sim.Results[0].Auth
+	}
+	return nil
+}
+
+// Returns the hash that must be signed to authorize a Soroban
+// authorization entry with address credentials, or nil if entry has
+// some other type of credentials.
+func (net *StellarNet) AuthEntryHash(
+	entry *stx.SorobanAuthorizationEntry) *stx.Hash {
+	if entry.Credentials.Type != stx.SOROBAN_CREDENTIALS_ADDRESS {
+		return nil
+	}
+	cred := entry.Credentials.Address()
+	pre := stx.HashIDPreimage{Type: stx.ENVELOPE_TYPE_SOROBAN_AUTHORIZATION}
+	auth := pre.SorobanAuthorization()
+	auth.NetworkID = sha256.Sum256([]byte(net.GetNetworkId()))
+	auth.Nonce = cred.Nonce
+	auth.SignatureExpirationLedger = cred.SignatureExpirationLedger
+	auth.Invocation = entry.RootInvocation
+	ret := stcdetail.XdrSHA256(&pre)
+	return &ret
+}
+
+// The signature of an account in SorobanAddressCredentials, which is
+// a vector of these structures sorted by PublicKey.
+type accountAuthSignature struct {
+	PublicKey []byte `scval:"public_key"`
+	Signature []byte `scval:"signature"`
+}
+
+// Signs a Soroban authorization entry that uses address credentials,
+// so that the entry is valid until ledger expirationLedger.  If the
+// entry's nonce is zero, first sets it to a random value.  The
+// signature has the format that Stellar accounts require.  If the
+// entry already has signatures with the same expiration ledger (as
+// for an account with multiple signers), the new signature is added
+// to them; otherwise it replaces any existing signatures.  Since the
+// entry is part of a transaction, any signatures on that transaction
+// become invalid.
+func (net *StellarNet) SignAuthEntry(sk stcdetail.PrivateKeyInterface,
+	entry *stx.SorobanAuthorizationEntry, expirationLedger uint32) error {
+	if entry.Credentials.Type != stx.SOROBAN_CREDENTIALS_ADDRESS {
+		return ErrNotAddressCredentials
+	}
+	cred := entry.Credentials.Address()
+	pk := sk.Public()
+	if pk.Type != stx.PUBLIC_KEY_TYPE_ED25519 {
+		return stx.StrKeyError("Invalid public key type")
+	}
+
+	var sigs []accountAuthSignature
+	if cred.Nonce != 0 && cred.SignatureExpirationLedger == expirationLedger {
+		if err := FromSCVal(&cred.Signature, &sigs); err != nil {
+			sigs = nil
+		}
+	} else if cred.Nonce == 0 {
+		var nonce [8]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return err
+		}
+		cred.Nonce = int64(binary.BigEndian.Uint64(nonce[:]) >> 1)
+	}
+	cred.SignatureExpirationLedger = expirationLedger
+
+	sig, err := sk.Sign(net.AuthEntryHash(entry)[:])
+	if err != nil {
+		return err
+	}
+	newsig := accountAuthSignature{
+		PublicKey: append([]byte{}, pk.Ed25519()[:]...),
+		Signature: sig,
+	}
+	replaced := false
+	for i := range sigs {
+		if bytes.Equal(sigs[i].PublicKey, newsig.PublicKey) {
+			sigs[i], replaced = newsig, true
+		}
+	}
+	if !replaced {
+		sigs = append(sigs, newsig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		return bytes.Compare(sigs[i].PublicKey, sigs[j].PublicKey) < 0
+	})
+	cred.Signature, err = ToSCVal(sigs)
+	return err
+}
+
+// Returns the Soroban authorization entries in a transaction whose
+// address credentials are for Stellar account pk.
+func AuthEntriesFor(e *TransactionEnvelope,
+	pk stx.PublicKey) []*stx.SorobanAuthorizationEntry {
+	op := sorobanOp(e)
+	if op == nil || op.Type != stx.INVOKE_HOST_FUNCTION ||
+		pk.Type != stx.PUBLIC_KEY_TYPE_ED25519 {
+		return nil
+	}
+	var ret []*stx.SorobanAuthorizationEntry
+	auth := op.InvokeHostFunctionOp().Auth
+	for i := range auth {
+		if auth[i].Credentials.Type != stx.SOROBAN_CREDENTIALS_ADDRESS {
+			continue
+		}
+		addr := &auth[i].Credentials.Address().Address
+		if addr.Type == stx.SC_ADDRESS_TYPE_ACCOUNT &&
+			addr.AccountId().Type == pk.Type &&
+			*addr.AccountId().Ed25519() == *pk.Ed25519() {
+			ret = append(ret, &auth[i])
+		}
+	}
+	return ret
+}
+
+// Signs all of the Soroban authorization entries in a transaction
+// whose address credentials are for the Stellar account of sk (see
+// SignAuthEntry).  Returns the number of entries signed.  Since this
+// changes the transaction, call it before SignTx.
+func (net *StellarNet) SignAuthEntries(sk stcdetail.PrivateKeyInterface,
+	e *TransactionEnvelope, expirationLedger uint32) (int, error) {
+	entries := AuthEntriesFor(e, sk.Public())
+	for i, entry := range entries {
+		if err := net.SignAuthEntry(sk, entry, expirationLedger); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
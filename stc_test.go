@@ -1,12 +1,27 @@
 package stc
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/ini"
 	"github.com/xdrpp/stc/stcdetail"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 import "github.com/xdrpp/stc/stx"
@@ -132,6 +147,72 @@ func TestStrkeyVectors(t *testing.T) {
 			t.Errorf("Round-trip strkey failed for %q", tvecs[i].strkey)
 		}
 	}
+
+	hash := []byte{
+		0x36, 0x3e, 0xaa, 0x38, 0x67, 0x84, 0x1f, 0xba,
+		0xd0, 0xf4, 0xed, 0x88, 0xc7, 0x79, 0xe4, 0xfe,
+		0x66, 0xe5, 0x6a, 0x24, 0x70, 0xdc, 0x98, 0xc0,
+		0xec, 0x9c, 0x07, 0x3d, 0x05, 0xc7, 0xb1, 0x03,
+	}
+	avecs := [...]tvec{
+		{
+			"CA3D5KRYM6CB7OWQ6TWYRR3Z4T7GNZLKERYNZGGA5SOAOPIFY6YQGAXE",
+			append([]byte{0x00, 0x00, 0x00, 0x01}, hash...),
+		},
+		{
+			"LA3D5KRYM6CB7OWQ6TWYRR3Z4T7GNZLKERYNZGGA5SOAOPIFY6YQGZ5J",
+			append([]byte{0x00, 0x00, 0x00, 0x04}, hash...),
+		},
+		{
+			"BAAD6DBUX6J22DMZOHIEZTEQ64CVCHEDRKWZONFEUL5Q26QD7R76RGR4TU",
+			append([]byte{0x00, 0x00, 0x00, 0x03}, tvecs[0].bin...),
+		},
+		{
+			"GA7QYNF7SOWQ3GLR2BGMZEHXAVIRZA4KVWLTJJFC7MGXUA74P7UJVSGZ",
+			append([]byte{0x00, 0x00, 0x00, 0x00}, tvecs[0].bin...),
+		},
+	}
+	for i := range avecs {
+		var a stx.SCAddress
+		if _, err := fmt.Sscan(avecs[i].strkey, &a); err != nil {
+			t.Errorf("Could not scan SCAddress %q %s", avecs[i].strkey, err)
+		} else if bin := stcdetail.XdrToBin(&a); bin != string(avecs[i].bin) {
+			t.Errorf("Incorrectly scanned SCAddress %q", avecs[i].strkey)
+		} else if a.String() != avecs[i].strkey {
+			t.Errorf("Round-trip strkey failed for %q", avecs[i].strkey)
+		}
+	}
+
+	var pool stx.PoolID
+	if err := stx.XDR_PoolID(&pool).UnmarshalText(
+		[]byte(avecs[1].strkey)); err != nil {
+		t.Error(err)
+	} else if string(pool[:]) != string(hash) ||
+		stx.XDR_PoolID(&pool).String() != avecs[1].strkey {
+		t.Errorf("PoolID strkey round trip failed")
+	}
+	var cb stx.ClaimableBalanceID
+	if err := cb.UnmarshalText([]byte(avecs[2].strkey)); err != nil {
+		t.Error(err)
+	} else if cb.String() != avecs[2].strkey {
+		t.Errorf("ClaimableBalanceID strkey round trip failed")
+	}
+
+	for _, bad := range []string{
+		// Invalid checksum
+		"CA3D5KRYM6CB7OWQ6TWYRR3Z4T7GNZLKERYNZGGA5SOAOPIFY6YQGAXF",
+		// Payload too short
+		"CA3D5KRYM6CB7OWQ6TWYRR3Z4T7GNZLKERYNZGGA5SOAOPIFY6YQGAX",
+		// Invalid claimable balance type
+		"BAAT6DBUX6J22DMZOHIEZTEQ64CVCHEDRKWZONFEUL5Q26QD7R76RGXACA",
+		// Claimable balance without a type byte
+		"BA7QYNF7SOWQ3GLR2BGMZEHXAVIRZA4KVWLTJJFC7MGXUA74P7UJUWDA",
+	} {
+		var a stx.SCAddress
+		if err := a.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("Accepted invalid address %q", bad)
+		}
+	}
 }
 
 func TestMuxDemux(t *testing.T) {
@@ -205,6 +286,17 @@ func TestLiquidityPoolID(t *testing.T) {
 	}
 }
 
+func TestNewSignerHashX(t *testing.T) {
+	x := stx.Hash{1, 2, 3}
+	s := NewSignerHashX(x, 2)
+	if s.Key.Type != stx.SIGNER_KEY_TYPE_HASH_X || *s.Key.HashX() != x ||
+		s.Weight != 2 {
+		t.Errorf("bad hash-X signer %s weight %d", &s.Key, s.Weight)
+	} else if str := s.Key.String(); str[0] != 'X' {
+		t.Errorf("hash-X signer renders as %s", str)
+	}
+}
+
 func TestInvalidDefault(t *testing.T) {
 	net := DefaultStellarNet("test")
 	if net == nil {
@@ -238,6 +330,94 @@ func TestAppend(t *testing.T) {
 	})
 }
 
+func TestNewFeeBump(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	sk := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	payer := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+
+	txe := NewTransactionEnvelope()
+	txe.Type = stx.ENVELOPE_TYPE_TX_V0
+	txe.SetSourceAccount(sk.Public())
+	txe.V0().Tx.SeqNum = 5
+	txe.V0().Tx.TimeBounds = &stx.TimeBounds{MaxTime: 1 << 40}
+	txe.Append(nil, BumpSequence{BumpTo: 10})
+	txe.SetFee(100)
+	net.SignTx(sk, txe)
+	hash := *net.HashTx(txe)
+
+	fb := NewFeeBump(txe, payer.Public(), 1000)
+	if fb.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP ||
+		fb.FeeBump().Tx.Fee != 1000 {
+		t.Fatal("bad fee bump envelope")
+	}
+	if fs := fb.SourceAccount().ToSignerKey(); fs.String() !=
+		payer.Public().String() {
+		t.Errorf("fee source is %s", fs)
+	}
+	inner := fb.FeeBump().Tx.InnerTx.V1()
+	if *net.HashTx(inner) != hash {
+		t.Error("converting V0 to V1 changed the transaction hash")
+	}
+	pk := sk.Public().ToSignerKey()
+	if len(inner.Signatures) != 1 ||
+		!net.VerifySig(&pk, inner, inner.Signatures[0].Signature) {
+		t.Error("inner signature not preserved")
+	}
+
+	defer failUnlessPanic(t)
+	NewFeeBump(fb, payer.Public(), 1000)
+}
+
+func TestMergeSignatures(t *testing.T) {
+	net := &StellarNet{
+		NetworkId: "Stub Network ; January 2024",
+		Signers:   SignerCache{},
+	}
+	sk1 := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	sk2 := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	sk3 := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	net.AddSigner(sk1.Public().String(), "")
+	net.AddSigner(sk2.Public().String(), "")
+
+	txe := NewTransactionEnvelope()
+	txe.SetSourceAccount(sk1.Public())
+	txe.Append(nil, Inflation{})
+	copies := make([]*TransactionEnvelope, 3)
+	for i := range copies {
+		copies[i], _ = TxFromBase64(TxToBase64(txe))
+	}
+	net.SignTx(sk1, copies[0])
+	net.SignTx(sk2, copies[1])
+	net.SignTx(sk1, copies[2])
+	net.SignTx(sk2, copies[2])
+
+	e, err := MergeSignatures(net, copies...)
+	if err != nil {
+		t.Fatal(err)
+	} else if sigs := *e.Signatures(); len(sigs) != 2 ||
+		sigs[0].Hint != sk1.Public().Hint() ||
+		sigs[1].Hint != sk2.Public().Hint() {
+		t.Errorf("merged signatures %v", sigs)
+	} else if len(*copies[0].Signatures()) != 1 {
+		t.Error("MergeSignatures modified its input")
+	}
+
+	net.SignTx(sk3, copies[1])
+	if _, err = MergeSignatures(net, copies...); err == nil {
+		t.Error("accepted signature from unknown signer")
+	} else if me, ok := err.(MergeError); !ok || me.Index != 1 {
+		t.Errorf("unknown signer gave %v", err)
+	}
+
+	copies[1], _ = TxFromBase64(TxToBase64(txe))
+	copies[1].V1().Tx.SeqNum++
+	if _, err = MergeSignatures(net, copies...); err == nil {
+		t.Error("accepted different transaction")
+	} else if me, ok := err.(MergeError); !ok || me.Index != 1 {
+		t.Errorf("different transaction gave %v", err)
+	}
+}
+
 func TestMaxInt64(t *testing.T) {
 	if MaxInt64 != 9223372036854775807 {
 		t.Error("MaxInt64 is wrong")
@@ -288,6 +468,141 @@ func TestParseTxrep(t *testing.T) {
 	}
 }
 
+func TestParseTxrepHexBalanceID(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	var op ClaimClaimableBalance
+	op.BalanceID.Type = stx.CLAIMABLE_BALANCE_ID_TYPE_V0
+	op.BalanceID.V0()[0] = 0xab
+	op.BalanceID.V0()[31] = 0xcd
+	txe := NewTransactionEnvelope()
+	txe.Append(nil, op)
+
+	rep := net.TxToRep(txe)
+	strkey := op.BalanceID.String()
+	if !strings.Contains(rep, strkey) {
+		t.Fatalf("balance ID %s not in txrep:\n%s", strkey, rep)
+	}
+	hexid := "00000000" + hex.EncodeToString(op.BalanceID.V0()[:])
+	txe2, err := TxFromRep(strings.Replace(rep, strkey, hexid, 1))
+	if err != nil {
+		t.Errorf("parsing hex balance ID failed: %s", err)
+	} else if TxToBase64(txe) != TxToBase64(txe2) {
+		t.Error("hex balance ID parsed incorrectly")
+	}
+}
+
+func TestAmount(t *testing.T) {
+	var issuer AccountID
+	fmt.Sscan("GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L",
+		&issuer)
+	cases := []struct {
+		in     string
+		amount Amount
+		asset  string
+	}{
+		{"12.5", 125000000, ""},
+		{"12.5e7", 125000000, ""},
+		{"1,000.25", 10002500000, ""},
+		{"7e0 native", 7, "native"},
+		{" 0.5  XLM ", 5000000, "native"},
+		{"3 USD:" + issuer.String(), 30000000, "USD:" + issuer.String()},
+	}
+	for _, c := range cases {
+		a, asset, err := ParseAmount(c.in)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %s", c.in, err)
+		} else if a != c.amount {
+			t.Errorf("ParseAmount(%q) = %d", c.in, a)
+		} else if c.asset == "" && asset != nil ||
+			c.asset != "" && (asset == nil || asset.String() != c.asset) {
+			t.Errorf("ParseAmount(%q) has asset %v", c.in, asset)
+		}
+	}
+	for _, in := range []string{"", "1.00000001", "1 2 3", "1 USD:X"} {
+		if _, _, err := ParseAmount(in); err == nil {
+			t.Errorf("ParseAmount(%q) should fail", in)
+		}
+	}
+
+	var a Amount
+	if a = 10002500000; a.String() != "1,000.25e7" {
+		t.Errorf("Amount prints as %s", a)
+	} else if text, _ := a.MarshalText(); string(text) != "1000.2500000" {
+		t.Errorf("Amount marshals as %s", text)
+	} else if _, err := fmt.Sscan(a.String(), &a); err != nil ||
+		a != 10002500000 {
+		t.Errorf("Amount scanned as %d (%v)", a, err)
+	}
+
+	txe := NewTransactionEnvelope()
+	txe.SetSourceAccount(issuer)
+	txe.Append(nil, Payment{Destination: *issuer.ToMuxedAccount()})
+	rep := strings.Replace(DefaultStellarNet("test").TxToRep(txe),
+		"paymentOp.amount: 0", "paymentOp.amount: 1,000.25e7 (lumens)", 1)
+	if txe, err := TxFromRep(rep); err != nil {
+		t.Error(err)
+	} else if amt := txe.V1().Tx.Operations[0].Body.PaymentOp().Amount; amt !=
+		10002500000 {
+		t.Errorf("txrep amount parsed as %d", amt)
+	}
+	rep = strings.Replace(rep, "1,000.25e7", "1.000000001e7", 1)
+	if _, err := TxFromRep(rep); err == nil {
+		t.Error("txrep accepted fractional stroops")
+	}
+	rep = strings.Replace(rep, "1.000000001e7", "12.5", 1)
+	if _, err := TxFromRep(rep); err == nil {
+		t.Error("txrep accepted decimal amount without exponent")
+	}
+}
+
+func TestRenderTxrepTemplate(t *testing.T) {
+	tmpl := `$memo: rent
+$amount: 1
+
+type: ENVELOPE_TYPE_TX
+tx.sourceAccount: GDFR4HZMNZCNHFEIBWDQCC4JZVFQUGXUQ473EJ4SUPFOJ3XBG5DUCS2G
+tx.memo.type: MEMO_TEXT
+tx.memo.text: "${memo} $$5"
+tx.operations.len: 1
+tx.operations[0].sourceAccount._present: false
+tx.operations[0].body.type: PAYMENT
+tx.operations[0].body.paymentOp.destination: ${dest}
+tx.operations[0].body.paymentOp.asset: native
+tx.operations[0].body.paymentOp.amount: ${amount}e7
+`
+	dest := "GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L"
+	e, err := RenderTxrepTemplate(strings.NewReader(tmpl),
+		map[string]string{"dest": dest, "amount": "12.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memo := *e.V1().Tx.Memo.Text(); memo != "rent $5" {
+		t.Errorf("memo is %q", memo)
+	}
+	pay := e.V1().Tx.Operations[0].Body.PaymentOp()
+	if pay.Destination.String() != dest || pay.Amount != 125000000 {
+		t.Errorf("bad payment %s %d", pay.Destination, pay.Amount)
+	}
+
+	_, err = RenderTxrepTemplate(strings.NewReader(tmpl),
+		map[string]string{"amount": "x"})
+	te, ok := err.(stcdetail.TxrepError)
+	if !ok || len(te) != 1 || te[0].Line != 11 {
+		t.Errorf("missing variable gave %v", err)
+	}
+	_, err = RenderTxrepTemplate(strings.NewReader(tmpl),
+		map[string]string{"dest": dest, "amount": "x"})
+	if te, ok = err.(stcdetail.TxrepError); !ok || len(te) != 1 ||
+		te[0].Line != 13 {
+		t.Errorf("bad amount gave %v", err)
+	}
+	_, err = RenderTxrepTemplate(strings.NewReader("$x\ntype: ${y"), nil)
+	if te, ok = err.(stcdetail.TxrepError); !ok || len(te) != 2 ||
+		te[0].Line != 1 || te[1].Line != 2 {
+		t.Errorf("bad template gave %v", err)
+	}
+}
+
 func TestXdr(t *testing.T) {
 	var yourkey PublicKey
 	fmt.Sscan("GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L",
@@ -333,6 +648,1483 @@ func TestXdr(t *testing.T) {
 	}
 }
 
+const stubFeeStats = `{
+  "last_ledger": "1000",
+  "last_ledger_base_fee": "100",
+  "ledger_capacity_usage": "0.5",
+  "fee_charged": {"max": "100", "min": "100", "mode": "100",
+    "p10": "100", "p50": "100", "p99": "100"},
+  "max_fee": {"max": "5000", "min": "100", "mode": "100",
+    "p10": "100", "p20": "150", "p50": "200", "p99": "5000"}
+}`
+
+type headerTransport struct {
+	key, val string
+}
+
+func (h headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(h.key, h.val)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Starts a stub horizon server that requires the X-Stub-Auth header
+// to be set, and returns its base URL.
+func newStubServer(t *testing.T, handler http.HandlerFunc) string {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Stub-Auth") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/"
+}
+
+// Returns a StellarNet talking to a stub horizon server (see
+// newStubServer).
+func newStubNet(t *testing.T, handler http.HandlerFunc) *StellarNet {
+	return &StellarNet{
+		Name:       "stub",
+		NetworkId:  "Stub Network ; January 2024",
+		Horizon:    newStubServer(t, handler),
+		HTTPClient: &http.Client{Transport: headerTransport{"X-Stub-Auth", "secret"}},
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			MinDelay:    time.Millisecond,
+		},
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fee_stats":
+			fmt.Fprint(w, stubFeeStats)
+		case "/slow":
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	fs, err := net.GetFeeStatsCtx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if fee := fs.Percentile(20); fee != 150 {
+		t.Errorf("expected 20th percentile fee 150, got %d", fee)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	if _, err = net.GetCtx(ctx, "slow"); err == nil {
+		t.Error("GetCtx ignored context deadline")
+	}
+
+	net.HTTPClient = nil
+	if _, err = net.GetFeeStats(); err == nil {
+		t.Error("request without custom HTTPClient should have failed")
+	}
+}
+
+func TestHorizonFailover(t *testing.T) {
+	unavailable := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	var posts int32
+	fallback := newStubServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			atomic.AddInt32(&posts, 1)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, stubFeeStats)
+	})
+
+	net := newStubNet(t, unavailable)
+	net.HorizonFallbacks = []string{fallback}
+	if _, err := net.GetFeeStats(); err != nil {
+		t.Errorf("GetFeeStats did not fail over: %s", err)
+	}
+
+	net = newStubNet(t, unavailable)
+	net.HorizonFallbacks = []string{fallback}
+	if _, err := net.Post(NewTransactionEnvelope()); err == nil {
+		t.Error("Post to unavailable server should have failed")
+	} else if posts != 0 {
+		t.Error("Post was sent to a second server")
+	}
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	net.Horizon = dead.URL + "/"
+	net.Post(NewTransactionEnvelope())
+	if posts != 1 {
+		t.Error("Post did not fail over after connection failure")
+	}
+}
+
+func TestHorizonRoundRobin(t *testing.T) {
+	var counts [2]int32
+	count := func(i int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&counts[i], 1)
+			fmt.Fprint(w, "{}")
+		}
+	}
+	net := newStubNet(t, count(0))
+	net.HorizonFallbacks = []string{newStubServer(t, count(1))}
+	for i := 0; i < 4; i++ {
+		net.Get("ledgers")
+	}
+	if counts != [2]int32{4, 0} {
+		t.Errorf("requests without round-robin were spread as %v", counts)
+	}
+	net.HorizonRoundRobin = true
+	for i := 0; i < 4; i++ {
+		net.Get("ledgers")
+	}
+	if counts != [2]int32{6, 2} {
+		t.Errorf("round-robin requests were spread as %v", counts)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var gets, posts int32
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			atomic.AddInt32(&posts, 1)
+			w.WriteHeader(http.StatusGatewayTimeout)
+		} else if atomic.AddInt32(&gets, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			fmt.Fprint(w, stubFeeStats)
+		}
+	})
+	if _, err := net.GetFeeStats(); err != nil {
+		t.Error(err)
+	} else if gets != 2 {
+		t.Errorf("expected 2 GET requests, got %d", gets)
+	}
+	if _, err := net.Post(NewTransactionEnvelope()); !IsTemporary(err) {
+		t.Errorf("expected temporary error, got %v", err)
+	} else if posts != 3 {
+		t.Errorf("expected 3 POST requests, got %d", posts)
+	}
+
+	retry := RetryPolicy{
+		MinDelay: time.Second,
+		MaxDelay: 5 * time.Second,
+	}
+	for i, want := range []time.Duration{1, 2, 4, 5, 5} {
+		if d := retry.Delay(i+1, nil); d != want*time.Second {
+			t.Errorf("attempt %d: expected delay %s, got %s",
+				i+1, want*time.Second, d)
+		}
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests,
+		Header: http.Header{}}
+	resp.Header.Set("Retry-After", "86400")
+	herr := &stcdetail.HTTPerror{Resp: resp}
+	retry.MaxAttempts = 2
+	if d := retry.Delay(1, herr); d != retry.MaxDelay {
+		t.Errorf("Retry-After delay %s not limited to %s", d, retry.MaxDelay)
+	} else if start := time.Now(); retry.Wait(nil, 1, herr) ||
+		time.Since(start) > time.Second {
+		t.Error("waited for Retry-After longer than MaxDelay")
+	}
+}
+
+func TestPostAndWait(t *testing.T) {
+	e := NewTransactionEnvelope()
+	var res TransactionResult
+	res.Result.Code = stx.TxSUCCESS
+	var meta stx.TransactionMeta
+	var txid string
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transactions/":
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case "/transactions/" + txid:
+			fmt.Fprintf(w, `{"hash": "%s", "ledger": 7,
+  "created_at": "2024-01-02T03:04:05Z",
+  "envelope_xdr": "%s", "result_xdr": "%s",
+  "result_meta_xdr": "%s", "fee_meta_xdr": "AAAAAA=="}`, txid,
+				stcdetail.XdrToBase64(e), stcdetail.XdrToBase64(&res),
+				stcdetail.XdrToBase64(&meta))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	net.RetryPolicy = &RetryPolicy{}
+	txid = hex.EncodeToString(net.HashTx(e)[:])
+
+	txr, err := net.PostAndWait(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	} else if txr.Ledger != 7 || txr.Result.Result.Code != stx.TxSUCCESS {
+		t.Errorf("unexpected result %v", txr)
+	}
+
+	// Without time bounds, give up after PostWaitTimeout.
+	defer func(d time.Duration) { PostWaitTimeout = d }(PostWaitTimeout)
+	PostWaitTimeout = 100 * time.Millisecond
+	e.Append(nil, BumpSequence{BumpTo: 1})
+	txid = "none"
+	if _, err = net.PostAndWait(nil, e); !errors.Is(err,
+		context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestPostAsync(t *testing.T) {
+	var res TransactionResult
+	res.Result.Code = stx.TxBAD_SEQ
+	statuses := []struct {
+		code int
+		body string
+	}{
+		{http.StatusCreated, `{"tx_status": "PENDING"}`},
+		{http.StatusConflict, `{"tx_status": "DUPLICATE"}`},
+		{http.StatusServiceUnavailable, `{"tx_status": "TRY_AGAIN_LATER"}`},
+		{http.StatusBadRequest, `{"tx_status": "ERROR", "errorResultXdr": "` +
+			stcdetail.XdrToBase64(&res) + `"}`},
+	}
+	var i int
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/transactions_async" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(statuses[i].code)
+		fmt.Fprint(w, statuses[i].body)
+	})
+	for i = range statuses {
+		status, err := net.PostAsync(nil, NewTransactionEnvelope())
+		if status != AsyncTxStatus(i) {
+			t.Errorf("expected status %s, got %s", AsyncTxStatus(i), status)
+		}
+		if f, ok := err.(TxFailure); status == AsyncError &&
+			(!ok || f.Result.Code != stx.TxBAD_SEQ) {
+			t.Errorf("expected txBAD_SEQ failure, got %v", err)
+		} else if status != AsyncError && err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRPC(t *testing.T) {
+	var key stx.LedgerKey
+	key.Type = stx.ACCOUNT
+	fmt.Sscan("GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L",
+		&key.Account().AccountID)
+	var entry stx.XdrAnon_LedgerEntry_Data
+	entry.Type = stx.ACCOUNT
+	entry.Account().Balance = 12345
+	var txdata stx.SorobanTransactionData
+	txdata.Resources.Instructions = 5000
+	var retval, topic stx.SCVal
+	retval.Type = stx.SCV_U32
+	*retval.U32() = 7
+	topic.Type = stx.SCV_SYMBOL
+	*topic.Sym() = "transfer"
+	var txres TransactionResult
+	txres.Result.Code = stx.TxINSUFFICIENT_FEE
+
+	results := map[string]string{
+		"getHealth": `{"status": "healthy", "latestLedger": 100,
+  "oldestLedger": 1, "ledgerRetentionWindow": 99}`,
+		"getNetwork": `{"passphrase": "Stub Network ; January 2024",
+  "protocolVersion": 22}`,
+		"getLatestLedger": `{"id": "` + strings.Repeat("ab", 32) + `",
+  "protocolVersion": 22, "sequence": 100}`,
+		"getLedgerEntries": `{"entries": [{"key": "` +
+			stcdetail.XdrToBase64(&key) + `", "xdr": "` +
+			stcdetail.XdrToBase64(&entry) + `",
+  "lastModifiedLedgerSeq": 90}], "latestLedger": 100}`,
+		"simulateTransaction": `{"transactionData": "` +
+			stcdetail.XdrToBase64(&txdata) + `", "minResourceFee": "1234",
+  "results": [{"auth": [], "xdr": "` + stcdetail.XdrToBase64(&retval) +
+			`"}], "cost": {"cpuInsns": "4000", "memBytes": "300"},
+  "latestLedger": 100}`,
+		"sendTransaction": `{"status": "ERROR", "hash": "` +
+			strings.Repeat("cd", 32) + `", "latestLedger": 100,
+  "latestLedgerCloseTime": "1700000000", "errorResultXdr": "` +
+			stcdetail.XdrToBase64(&txres) + `"}`,
+		"getTransaction": `{"status": "NOT_FOUND", "latestLedger": 100}`,
+		"getEvents": `{"events": [{"type": "contract", "ledger": 99,
+  "ledgerClosedAt": "2024-01-02T03:04:05Z", "id": "0001-1",
+  "topic": ["` + stcdetail.XdrToBase64(&topic) + `"], "value": "` +
+			stcdetail.XdrToBase64(&retval) + `"}], "latestLedger": 100,
+  "cursor": "0001-1"}`,
+	}
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id     int
+			Method string
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if res, ok := results[req.Method]; ok {
+			fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": %d, "result": %s}`,
+				req.Id, res)
+		} else {
+			fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": %d, "error":
+  {"code": -32601, "message": "method not found"}}`, req.Id)
+		}
+	})
+	net.RPC = net.Horizon
+	ctx := context.Background()
+
+	if h, err := net.RPCGetHealth(ctx); err != nil {
+		t.Error(err)
+	} else if h.Status != "healthy" || h.LedgerRetentionWindow != 99 {
+		t.Errorf("bad health %+v", h)
+	}
+	if n, err := net.RPCGetNetwork(ctx); err != nil {
+		t.Error(err)
+	} else if n.Passphrase != net.NetworkId {
+		t.Errorf("bad passphrase %q", n.Passphrase)
+	}
+	if l, err := net.RPCGetLatestLedger(ctx); err != nil {
+		t.Error(err)
+	} else if l.Sequence != 100 || l.Id[0] != 0xab {
+		t.Errorf("bad latest ledger %+v", l)
+	}
+	if es, err := net.RPCGetLedgerEntries(ctx, key); err != nil {
+		t.Error(err)
+	} else if len(es.Entries) != 1 ||
+		es.Entries[0].Data.Account().Balance != 12345 ||
+		es.Entries[0].Key.Account().AccountID.String() !=
+			key.Account().AccountID.String() {
+		t.Errorf("bad ledger entries %+v", es)
+	}
+	if sim, err := net.RPCSimulateTransaction(ctx,
+		NewTransactionEnvelope()); err != nil {
+		t.Error(err)
+	} else if sim.MinResourceFee != 1234 ||
+		sim.TransactionData.Resources.Instructions != 5000 ||
+		len(sim.Results) != 1 || *sim.Results[0].Retval.U32() != 7 ||
+		sim.Cost.CpuInsns != 4000 {
+		t.Errorf("bad simulation result %+v", sim)
+	}
+	if sr, err := net.RPCSendTransaction(ctx,
+		NewTransactionEnvelope()); sr == nil || sr.Status != AsyncError {
+		t.Errorf("bad send result %+v, %v", sr, err)
+	} else if f, ok := err.(TxFailure); !ok ||
+		f.Result.Code != stx.TxINSUFFICIENT_FEE {
+		t.Errorf("expected TxFailure, got %v", err)
+	} else if sr.LatestLedgerCloseTime.Unix() != 1700000000 {
+		t.Errorf("bad close time %s", sr.LatestLedgerCloseTime)
+	}
+	if tr, err := net.RPCGetTransaction(ctx,
+		strings.Repeat("cd", 32)); err != nil {
+		t.Error(err)
+	} else if tr.Status != "NOT_FOUND" {
+		t.Errorf("bad transaction status %q", tr.Status)
+	}
+	if ev, err := net.RPCGetEvents(ctx, 90, "", 10); err != nil {
+		t.Error(err)
+	} else if len(ev.Events) != 1 || ev.Cursor != "0001-1" ||
+		*ev.Events[0].Topic[0].Sym() != "transfer" ||
+		*ev.Events[0].Value.U32() != 7 {
+		t.Errorf("bad events %+v", ev)
+	}
+	if err := net.RPCCall(ctx, "bogus", nil, nil); err == nil {
+		t.Error("bogus RPC method should have failed")
+	} else if rerr, ok := err.(*RPCError); !ok || rerr.Code != -32601 {
+		t.Errorf("expected RPCError, got %v", err)
+	}
+}
+
+func TestPrepareSoroban(t *testing.T) {
+	var txdata stx.SorobanTransactionData
+	txdata.Resources.Instructions = 5000
+	txdata.ResourceFee = 1234
+	var auth stx.SorobanAuthorizationEntry
+	auth.Credentials.Type = stx.SOROBAN_CREDENTIALS_SOURCE_ACCOUNT
+	var retval stx.SCVal
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": 1, "result": {
+  "transactionData": "%s", "minResourceFee": "1234",
+  "results": [{"auth": ["%s"], "xdr": "%s"}], "latestLedger": 100}}`,
+			stcdetail.XdrToBase64(&txdata), stcdetail.XdrToBase64(&auth),
+			stcdetail.XdrToBase64(&retval))
+	})
+	net.RPC = net.Horizon
+
+	e := NewTransactionEnvelope()
+	if err := net.PrepareSoroban(nil, e); err != ErrNotSoroban {
+		t.Errorf("expected ErrNotSoroban, got %v", err)
+	}
+	e.Append(nil, InvokeHostFunction{})
+	e.V1().Tx.Fee = 100
+	for i := 0; i < 2; i++ {
+		if err := net.PrepareSoroban(nil, e); err != nil {
+			t.Fatal(err)
+		}
+		tx := &e.V1().Tx
+		if tx.Fee != 1334 || tx.Ext.V != 1 ||
+			tx.Ext.SorobanData().Resources.Instructions != 5000 ||
+			len(tx.Operations[0].Body.InvokeHostFunctionOp().Auth) != 1 {
+			t.Errorf("bad prepared transaction:\n%s", net.TxToRep(e))
+		}
+	}
+}
+
+func TestHorizonConfig(t *testing.T) {
+	net := StellarNet{Name: "main"}
+	sink := net.IniSink()
+	if err := ini.IniParseContents(sink, "first", []byte(`
+[net]
+horizon = https://a.example/
+[net "main"]
+horizon = https://b.example/
+horizon-round-robin = true
+`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ini.IniParseContents(sink, "second", []byte(`
+[net "main"]
+horizon = https://c.example/
+horizon-round-robin = false
+`)); err != nil {
+		t.Fatal(err)
+	}
+	if net.Horizon != "https://a.example/" ||
+		!reflect.DeepEqual(net.HorizonFallbacks,
+			[]string{"https://b.example/"}) || !net.HorizonRoundRobin {
+		t.Errorf("bad horizon configuration %q %q %v", net.Horizon,
+			net.HorizonFallbacks, net.HorizonRoundRobin)
+	}
+}
+
+func TestFeeStrategy(t *testing.T) {
+	var fs FeeStats
+	if err := json.Unmarshal([]byte(stubFeeStats), &fs); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		strategy string
+		fee      uint32
+	}{
+		{"", 150},
+		{"p50", 200},
+		{"max_fee.p99,max=1000", 1000},
+		{"fee_charged.p50", 100},
+		{"p50,surge=3", 200},
+		{"250", 250},
+	} {
+		var s FeeStrategy
+		if c.strategy == "" {
+			// zero value
+		} else if err := s.UnmarshalText([]byte(c.strategy)); err != nil {
+			t.Errorf("%q: %s", c.strategy, err)
+		} else if fee := s.BaseFee(&fs); fee != c.fee {
+			t.Errorf("%q: fee %d, expected %d", c.strategy, fee, c.fee)
+		}
+	}
+	fs.Ledger_capacity_usage = 0.95
+	s := FeeStrategy{Percentile: 50, SurgeMultiplier: 3}
+	if fee := s.BaseFee(&fs); fee != 600 {
+		t.Errorf("surge fee %d, expected 600", fee)
+	}
+	if err := s.UnmarshalText([]byte("p50,surge=2.5,max=10000")); err != nil {
+		t.Error(err)
+	} else if str := s.String(); str != "p50,surge=2.5,max=10000" {
+		t.Errorf("FeeStrategy rendered as %q", str)
+	}
+	for _, bad := range []string{"p0", "p100", "0", "surge", "x=1"} {
+		if err := s.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("accepted invalid fee strategy %q", bad)
+		}
+	}
+
+	txe := NewTransactionEnvelope()
+	txe.Append(nil, InvokeHostFunction{})
+	txe.V1().Tx.Ext.V = 1
+	txe.V1().Tx.Ext.SorobanData().ResourceFee = 5000
+	txe.SetFee(100)
+	if txe.V1().Tx.Fee != 5100 {
+		t.Errorf("Soroban fee %d, expected 5100", txe.V1().Tx.Fee)
+	}
+	fb := NewFeeBump(txe, AccountID{}, 0)
+	fb.SetFee(200)
+	if fb.FeeBump().Tx.Fee != 5400 {
+		t.Errorf("fee bump fee %d, expected 5400", fb.FeeBump().Tx.Fee)
+	}
+
+	net := StellarNet{Name: "main"}
+	if err := ini.IniParseContents(net.IniSink(), "", []byte(`
+[net "main"]
+fee-percentile = 50
+max-fee = 180
+fee-percentile = 10
+`)); err != nil {
+		t.Fatal(err)
+	} else if net.FeeStrategy.Percentile != 50 ||
+		net.FeeStrategy.MaxFee != 180 {
+		t.Errorf("bad fee configuration %s", net.FeeStrategy)
+	}
+	net.FeeCache, net.FeeCacheTime = &fs, time.Now()
+	if err := net.UpdateFee(nil, txe); err != nil {
+		t.Error(err)
+	} else if txe.V1().Tx.Fee != 5180 {
+		t.Errorf("UpdateFee set fee %d, expected 5180", txe.V1().Tx.Fee)
+	}
+}
+
+func TestSequenceTracker(t *testing.T) {
+	var loads, seq int64 = 0, 1000
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/accounts/") {
+			atomic.AddInt64(&loads, 1)
+			fmt.Fprintf(w, `{"sequence": "%d"}`, atomic.LoadInt64(&seq))
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	pk := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+
+	st := NewSequenceTracker(net, false)
+	const n = 20
+	var wg sync.WaitGroup
+	got := make([]stx.SequenceNumber, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if got[i], err = st.Next(nil, pk); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	for i := range got {
+		if got[i] != stx.SequenceNumber(1001+i) {
+			t.Fatalf("sequence numbers %v", got)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loaded account %d times", loads)
+	}
+
+	var res TransactionResult
+	res.Result.Code = stx.TxBAD_SEQ
+	if st.Resync(nil, pk, errors.New("other")) {
+		t.Error("resynced on unrelated error")
+	} else if !st.Resync(nil, pk, TxFailure{&res}) {
+		t.Error("did not resync on txBAD_SEQ")
+	}
+	atomic.StoreInt64(&seq, 5000)
+	if s, err := st.Next(nil, pk); err != nil || s != 5001 {
+		t.Errorf("after resync got %d (%v)", s, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "stub.seq")
+	st1 := &SequenceTracker{Net: net, Path: path}
+	st2 := &SequenceTracker{Net: net, Path: path}
+	loads = 0
+	for i, st := range []*SequenceTracker{st1, st2, st1} {
+		if s, err := st.Next(nil, pk); err != nil || s != 5001+
+			stx.SequenceNumber(i) {
+			t.Errorf("shared tracker %d got %d (%v)", i, s, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("shared trackers loaded account %d times", loads)
+	}
+	if contents, err := ioutil.ReadFile(path); err != nil ||
+		string(contents) != fmt.Sprintf("%s 5004\n", pk) {
+		t.Errorf("bad sequence file %q (%v)", contents, err)
+	}
+}
+
+func TestSequenceTrackerLoadUnlocked(t *testing.T) {
+	slow := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+	fast := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+	release := make(chan struct{})
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/accounts/"+slow.String() {
+			<-release
+		}
+		fmt.Fprint(w, `{"sequence": "1000"}`)
+	})
+	path := filepath.Join(t.TempDir(), "stub.seq")
+	st := &SequenceTracker{Net: net, Path: path}
+
+	done := make(chan error)
+	go func() {
+		_, err := st.Next(nil, slow)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if s, err := st.Next(nil, fast); err != nil || s != 1001 {
+		t.Errorf("got %d (%v) while another account was loading", s, err)
+	}
+
+	// A sequence number stored while loading wins if it is higher.
+	other := &SequenceTracker{Net: net, Path: path}
+	if err := other.locked(nil, func(seqs map[string]stx.SequenceNumber) {
+		seqs[seqKey(slow)] = 2000
+	}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if s, err := st.Next(nil, slow); err != nil || s != 2001 {
+		t.Errorf("got %d (%v), expected 2001", s, err)
+	}
+}
+
+func TestChannelPool(t *testing.T) {
+	var mu sync.Mutex
+	created := make(map[string]bool)
+	posted := make(map[string]*TransactionEnvelope)
+	var res TransactionResult
+	res.Result.Code = stx.TxSUCCESS
+	var meta stx.TransactionMeta
+	var net *StellarNet
+	net = newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/fee_stats":
+			fmt.Fprint(w, stubFeeStats)
+		case strings.HasPrefix(r.URL.Path, "/accounts/"):
+			if !created[strings.TrimPrefix(r.URL.Path, "/accounts/")] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"sequence": "1000"}`)
+		case r.Method == "POST" && r.URL.Path == "/transactions/":
+			e, err := TxFromBase64(r.FormValue("tx"))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, op := range *e.Operations() {
+				if op.Body.Type == stx.CREATE_ACCOUNT {
+					created[op.Body.CreateAccountOp().Destination.String()] =
+						true
+				}
+			}
+			posted[hex.EncodeToString(net.HashTx(e)[:])] = e
+			fmt.Fprintf(w, `{"result_xdr": "%s"}`,
+				stcdetail.XdrToBase64(&res))
+		case strings.HasPrefix(r.URL.Path, "/transactions/"):
+			txid := strings.TrimPrefix(r.URL.Path, "/transactions/")
+			e, ok := posted[txid]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"hash": "%s", "ledger": 7,
+  "created_at": "2024-01-02T03:04:05Z",
+  "envelope_xdr": "%s", "result_xdr": "%s",
+  "result_meta_xdr": "%s", "fee_meta_xdr": "AAAAAA=="}`, txid,
+				stcdetail.XdrToBase64(e), stcdetail.XdrToBase64(&res),
+				stcdetail.XdrToBase64(&meta))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	funder := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	owner := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	created[funder.Public().String()] = true
+	created[owner.Public().String()] = true
+	var keys []PrivateKey
+	for i := 0; i < 3; i++ {
+		keys = append(keys, NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519))
+	}
+	created[keys[1].Public().String()] = true
+	cp := NewChannelPool(net, keys...)
+
+	if _, err := cp.Bootstrap(nil, funder, 10000000); err != nil {
+		t.Fatal(err)
+	} else if len(posted) != 1 {
+		t.Fatalf("bootstrap posted %d transactions", len(posted))
+	}
+	for _, e := range posted {
+		if ops := *e.Operations(); len(ops) != 2 {
+			t.Errorf("bootstrap created %d channels", len(ops))
+		}
+	}
+	if res, err := cp.Bootstrap(nil, funder, 10000000); res != nil ||
+		err != nil {
+		t.Errorf("second bootstrap returned %v, %v", res, err)
+	}
+	posted = make(map[string]*TransactionEnvelope)
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e := NewTransactionEnvelope()
+			e.SetSourceAccount(owner.Public())
+			e.Append(nil, Payment{
+				Destination: *funder.Public().ToMuxedAccount(),
+				Asset:       NativeAsset(),
+				Amount:      int64(i + 1),
+			})
+			if _, err := cp.PostAndWait(nil, e, owner); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(posted) != n {
+		t.Fatalf("posted %d transactions", len(posted))
+	}
+	seqs := make(map[string]bool)
+	for _, e := range posted {
+		src := e.SourceAccount().String()
+		seq := fmt.Sprintf("%s %d", src, e.V1().Tx.SeqNum)
+		if seqs[seq] {
+			t.Errorf("duplicate sequence number %s", seq)
+		}
+		seqs[seq] = true
+		isChannel := false
+		for _, k := range keys {
+			isChannel = isChannel || k.Public().String() == src
+		}
+		if !isChannel {
+			t.Errorf("transaction source %s is not a channel", src)
+		}
+		op := (*e.Operations())[0]
+		if op.SourceAccount == nil ||
+			op.SourceAccount.String() != owner.Public().String() {
+			t.Errorf("operation source is %v", op.SourceAccount)
+		}
+		if e.V1().Tx.Fee != 150 {
+			t.Errorf("fee is %d", e.V1().Tx.Fee)
+		}
+		ownerKey := owner.Public().ToSignerKey()
+		if sigs := *e.Signatures(); len(sigs) != 2 ||
+			!net.VerifySig(&ownerKey, e, sigs[1].Signature) {
+			t.Errorf("bad signatures %v", sigs)
+		}
+	}
+}
+
+func TestChannelPoolRejected(t *testing.T) {
+	var mu sync.Mutex
+	var seq stx.SequenceNumber = 1000
+	posts := 0
+	var posted *TransactionEnvelope
+	var net *StellarNet
+	net = newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var res TransactionResult
+		res.Result.Code = stx.TxSUCCESS
+		switch {
+		case r.URL.Path == "/fee_stats":
+			fmt.Fprint(w, stubFeeStats)
+		case strings.HasPrefix(r.URL.Path, "/accounts/"):
+			fmt.Fprintf(w, `{"sequence": "%d"}`, seq)
+		case r.Method == "POST" && r.URL.Path == "/transactions/":
+			e, err := TxFromBase64(r.FormValue("tx"))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			posts++
+			if posts == 1 {
+				res.Result.Code = stx.TxINSUFFICIENT_FEE
+			} else if e.V1().Tx.SeqNum != seq+1 {
+				res.Result.Code = stx.TxBAD_SEQ
+			}
+			if res.Result.Code != stx.TxSUCCESS {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, `{"extras": {"result_xdr": "%s"}}`,
+					stcdetail.XdrToBase64(&res))
+				return
+			}
+			seq++
+			posted = e
+			fmt.Fprintf(w, `{"result_xdr": "%s"}`,
+				stcdetail.XdrToBase64(&res))
+		case posted != nil && r.URL.Path == "/transactions/"+
+			hex.EncodeToString(net.HashTx(posted)[:]):
+			var meta stx.TransactionMeta
+			fmt.Fprintf(w, `{"hash": "%x", "ledger": 7,
+  "created_at": "2024-01-02T03:04:05Z",
+  "envelope_xdr": "%s", "result_xdr": "%s",
+  "result_meta_xdr": "%s", "fee_meta_xdr": "AAAAAA=="}`,
+				net.HashTx(posted)[:],
+				stcdetail.XdrToBase64(posted), stcdetail.XdrToBase64(&res),
+				stcdetail.XdrToBase64(&meta))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	owner := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	cp := NewChannelPool(net, NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519))
+	newTx := func() *TransactionEnvelope {
+		e := NewTransactionEnvelope()
+		e.SetSourceAccount(owner.Public())
+		e.Append(nil, BumpSequence{})
+		return e
+	}
+
+	_, err := cp.PostAndWait(nil, newTx(), owner)
+	if f, ok := err.(TxFailure); !ok ||
+		f.Result.Code != stx.TxINSUFFICIENT_FEE {
+		t.Fatalf("first post returned %v", err)
+	}
+	e := newTx()
+	if _, err = cp.PostAndWait(nil, e, owner); err != nil {
+		t.Fatalf("second post returned %v", err)
+	} else if e.V1().Tx.SeqNum != 1001 {
+		t.Errorf("second post used sequence number %d", e.V1().Tx.SeqNum)
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/fee_stats":
+			fmt.Fprint(w, stubFeeStats)
+		case strings.HasPrefix(r.URL.Path, "/accounts/"):
+			fmt.Fprint(w, `{"sequence": "1000"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	payer := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+	dest := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+	pay := Payment{
+		Destination: *dest.ToMuxedAccount(),
+		Asset:       NativeAsset(),
+		Amount:      1,
+	}
+
+	b := NewBatcher(net, payer)
+	if txes, err := b.Build(nil); txes != nil || err != nil {
+		t.Errorf("empty batch built %v, %v", txes, err)
+	}
+	for i := 0; i < stx.MAX_OPS_PER_TX-1; i++ {
+		b.Add(nil, pay)
+	}
+	group := []stx.Operation{
+		{Body: CreateAccount{Destination: dest}.To_Operation_Body()},
+		{SourceAccount: dest.ToMuxedAccount(),
+			Body: ChangeTrust{Line: stx.ChangeTrustAsset{
+				Type: stx.ASSET_TYPE_POOL_SHARE}}.To_Operation_Body()},
+	}
+	b.AddGroup(group...)
+	for i := 0; i < stx.MAX_OPS_PER_TX+1; i++ {
+		b.Add(nil, pay)
+	}
+	if n := b.Len(); n != 2*stx.MAX_OPS_PER_TX+2 {
+		t.Errorf("Len is %d", n)
+	}
+
+	txes, err := b.Build(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []int{stx.MAX_OPS_PER_TX - 1, stx.MAX_OPS_PER_TX, 3}
+	if len(txes) != len(sizes) {
+		t.Fatalf("built %d transactions", len(txes))
+	}
+	for i, e := range txes {
+		tx := &e.V1().Tx
+		if len(tx.Operations) != sizes[i] {
+			t.Errorf("transaction %d has %d operations", i,
+				len(tx.Operations))
+		}
+		if tx.SeqNum != stx.SequenceNumber(1001+i) {
+			t.Errorf("transaction %d has sequence number %d", i, tx.SeqNum)
+		}
+		if tx.Fee != uint32(150*sizes[i]) {
+			t.Errorf("transaction %d has fee %d", i, tx.Fee)
+		}
+		if !sameAccount(&tx.SourceAccount, payer.ToMuxedAccount()) {
+			t.Errorf("transaction %d has source %s", i, &tx.SourceAccount)
+		}
+	}
+	if op := txes[1].V1().Tx.Operations[1]; op.Body.Type != stx.CHANGE_TRUST ||
+		op.SourceAccount == nil {
+		t.Errorf("group was split: %v", op)
+	}
+
+	b = NewBatcher(net, payer)
+	b.AddGroup(group[0], group[1], group[0])
+	b.MaxOps = 2
+	if txes, err := b.Build(nil); err == nil {
+		t.Errorf("oversized group built %d transactions", len(txes))
+	}
+
+	defer failUnlessPanic(t)
+	b.AddGroup(group[0], group[1], group[0])
+}
+
+func TestCheckSignatures(t *testing.T) {
+	master := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	cosigner := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	other := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	preimage := []byte("open sesame")
+	hashX := NewSignerHashX(sha256.Sum256(preimage), 1)
+	net := newStubNet(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/accounts/" + master.Public().String():
+			fmt.Fprintf(w, `{"sequence": "10",
+  "thresholds": {"low_threshold": 1, "med_threshold": 2,
+    "high_threshold": 3},
+  "signers": [{"key": "%s", "weight": 1}, {"key": "%s", "weight": 1},
+    {"key": "%s", "weight": 1}, {"key": "%s", "weight": 0}]}`,
+				master.Public(), cosigner.Public(), &hashX.Key, other.Public())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	e := NewTransactionEnvelope()
+	e.SetSourceAccount(master.Public())
+	e.Append(nil, Payment{
+		Destination: *other.Public().ToMuxedAccount(),
+		Asset:       NativeAsset(),
+		Amount:      1,
+	})
+	e.Append(other.Public().ToMuxedAccount(), BumpSequence{BumpTo: 1})
+	net.SignTx(master, e)
+
+	check := func(weight, otherWeight uint32, missing int) {
+		t.Helper()
+		sts, err := net.CheckSignatures(nil, e)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(sts) != 2 {
+			t.Fatalf("got %d statuses", len(sts))
+		}
+		if st := sts[0]; st.Level != stx.THRESHOLD_MED || st.Threshold != 2 ||
+			st.Weight != weight || len(st.Missing) != missing ||
+			st.Ok() != (weight >= 2) {
+			t.Errorf("bad status for source: %s", &st)
+		}
+		if st := sts[1]; st.Level != stx.THRESHOLD_LOW || st.Threshold != 1 ||
+			st.Weight != otherWeight || st.Ok() != (otherWeight >= 1) {
+			t.Errorf("bad status for operation source: %s", &st)
+		}
+	}
+	check(1, 0, 2)
+	*e.Signatures() = append(*e.Signatures(), stx.DecoratedSignature{
+		Hint:      hashX.Key.Hint(),
+		Signature: preimage,
+	})
+	net.SignTx(other, e)
+	check(2, 1, 1)
+
+	*e.Signatures() = nil
+	e.Append(nil, SetOptions{HighThreshold: NewUint(3)})
+	net.SignTx(master, e)
+	net.SignTx(cosigner, e)
+	if sts, err := net.CheckSignatures(nil, e); err != nil {
+		t.Fatal(err)
+	} else if sts[0].Level != stx.THRESHOLD_HIGH || sts[0].Ok() ||
+		len(sts[0].Missing) != 1 || sts[0].Missing[0].Key.String() != hashX.Key.String() {
+		t.Errorf("bad status for SetOptions: %s", &sts[0])
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	server := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	client := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	cosigner := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	wallet := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	serverID := server.Public()
+	walletID := wallet.Public()
+	domains := []string{"example.com", "example.org"}
+
+	e, err := net.NewChallenge(server, &Challenge{
+		Client:              *client.Public().ToMuxedAccount(),
+		Memo:                NewUhyper(7),
+		HomeDomain:          "example.org",
+		WebAuthDomain:       "auth.example.org",
+		ClientDomain:        "wallet.example",
+		ClientDomainAccount: &walletID,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := net.ReadChallenge(e, serverID, "auth.example.org", domains...)
+	if err != nil {
+		t.Fatal(err)
+	} else if ch.Client.String() != client.Public().String() ||
+		ch.Memo == nil || *ch.Memo != 7 || ch.HomeDomain != "example.org" ||
+		ch.ClientDomain != "wallet.example" ||
+		ch.ClientDomainAccount.String() != walletID.String() {
+		t.Errorf("bad challenge %+v", ch)
+	}
+	if _, err = net.ReadChallenge(e, serverID, "auth.example.com",
+		domains...); err == nil {
+		t.Error("accepted wrong web auth domain")
+	}
+	if _, err = net.ReadChallenge(e, client.Public(), "auth.example.org",
+		domains...); err == nil {
+		t.Error("accepted wrong server")
+	}
+
+	signers := []HorizonSigner{
+		{Key: client.Public().ToSignerKey(), Weight: 1},
+		{Key: cosigner.Public().ToSignerKey(), Weight: 1},
+	}
+	verify := func(threshold uint32) error {
+		_, err := net.VerifyChallenge(e, serverID, "auth.example.org",
+			domains, signers, threshold)
+		return err
+	}
+	net.SignTx(client, e)
+	if verify(1) == nil {
+		t.Error("accepted challenge not signed by client domain")
+	}
+	net.SignTx(wallet, e)
+	if err = verify(1); err != nil {
+		t.Error(err)
+	} else if verify(2) == nil {
+		t.Error("accepted challenge below threshold")
+	}
+	net.SignTx(cosigner, e)
+	if err = verify(2); err != nil {
+		t.Error(err)
+	}
+	net.SignTx(NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519), e)
+	if verify(2) == nil {
+		t.Error("accepted challenge with unknown signature")
+	}
+
+	e, _ = net.NewChallenge(server, &Challenge{
+		Client:        *client.Public().ToMuxedAccount(),
+		HomeDomain:    "example.com",
+		WebAuthDomain: "auth.example.org",
+	}, time.Minute)
+	tb := e.V1().Tx.Cond.TimeBounds()
+	tb.MinTime -= 3600
+	tb.MaxTime -= 3600
+	*e.Signatures() = nil
+	net.SignTx(server, e)
+	if _, err = net.ReadChallenge(e, serverID, "auth.example.org",
+		domains...); err == nil {
+		t.Error("accepted expired challenge")
+	}
+}
+
+func TestStellarURI(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	signer := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	dest := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	e := NewTransactionEnvelope()
+	e.SetSourceAccount(dest.Public())
+	e.Append(nil, BumpSequence{BumpTo: 5})
+
+	u := net.TxURI(e)
+	u.Callback = "https://example.com/sign?id=1"
+	u.Msg = "please sign & return"
+	u.OriginDomain = "example.com"
+	if err := u.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	s := u.String()
+	if !strings.HasPrefix(s, "web+stellar:tx?xdr=") ||
+		!strings.Contains(s, "msg=please%20sign%20%26%20return&") {
+		t.Errorf("bad URI %s", s)
+	}
+	pu, err := ParseStellarURI(s)
+	if err != nil {
+		t.Fatal(err)
+	} else if pu.Callback != u.Callback || pu.Msg != u.Msg ||
+		pu.Network() != net.NetworkId || pu.OriginDomain != "example.com" ||
+		*net.HashTx(pu.Envelope()) != *net.HashTx(e) {
+		t.Errorf("bad round trip %s", pu)
+	} else if !pu.Verify(signer.Public()) || pu.Verify(dest.Public()) {
+		t.Error("signature verification failed")
+	}
+	pu, err = ParseStellarURI(strings.Replace(s, "please", "do", 1))
+	if err != nil {
+		t.Fatal(err)
+	} else if pu.Verify(signer.Public()) {
+		t.Error("verified tampered URI")
+	}
+
+	s = fmt.Sprintf("web+stellar:pay?destination=%s&amount=12.5"+
+		"&asset_code=USD&asset_issuer=%s&memo=42&memo_type=MEMO_ID",
+		dest.Public(), signer.Public())
+	if pu, err = ParseStellarURI(s); err != nil {
+		t.Fatal(err)
+	} else if pu.Amount == nil || *pu.Amount != 125000000 ||
+		pu.Asset == nil || pu.Asset.String() != "USD:"+
+		signer.Public().String() || pu.Memo.Type != stx.MEMO_ID ||
+		*pu.Memo.Id() != 42 || pu.Network() == net.NetworkId {
+		t.Errorf("bad pay URI %+v", pu)
+	} else if pu.String() != s {
+		t.Errorf("round trip %s\n    != %s", pu, s)
+	}
+	op := &(*pu.Envelope().Operations())[0]
+	if p := op.Body.PaymentOp(); op.Body.Type != stx.PAYMENT ||
+		p.Amount != 125000000 || p.Destination.String() !=
+		dest.Public().String() {
+		t.Errorf("bad payment %s", net.TxToRep(pu.Envelope()))
+	}
+
+	for _, bad := range []string{
+		"web+stellar:foo?x=1",
+		"web+stellar:tx?xdr=AAAA",
+		"web+stellar:pay?destination=GXXX",
+		"web+stellar:tx?callback=https://x&xdr=" + TxToBase64(e),
+	} {
+		if _, err := ParseStellarURI(bad); err == nil {
+			t.Errorf("accepted invalid URI %s", bad)
+		}
+	}
+}
+
+func TestPrivateKeyFromMnemonic(t *testing.T) {
+	// Test 1 from SEP-5
+	words := "illness spike retreat truth genius clock brain pass " +
+		"fit cave bargain toe"
+	for _, v := range []struct {
+		index    uint32
+		pub, sec string
+	}{
+		{0, "GDRXE2BQUC3AZNPVFSCEZ76NJ3WWL25FYFK6RGZGIEKWE4SOOHSUJUJ6",
+			"SBGWSG6BTNCKCOB3DIFBGCVMUPQFYPA2G4O34RMTB343OYPXU5DJDVMN"},
+		{1, "GBAW5XGWORWVFE2XTJYDTLDHXTY2Q2MO73HYCGB3XMFMQ562Q2W2GJQX",
+			"SCEPFFWGAG5P2VX5DHIYK3XEMZYLTYWIPWYEKXFHSK25RVMIUNJ7CTIS"},
+	} {
+		sk, err := PrivateKeyFromMnemonic(words, "", v.index)
+		if err != nil {
+			t.Fatal(err)
+		} else if sk.Public().String() != v.pub || sk.String() != v.sec {
+			t.Errorf("index %d: got %s %s", v.index, sk.Public(), sk)
+		}
+	}
+	if _, err := PrivateKeyFromMnemonic("illness spike", "", 0); err == nil {
+		t.Error("accepted invalid mnemonic")
+	}
+	m := NewMnemonic()
+	if sk, err := PrivateKeyFromMnemonic(m, "", 1); err != nil {
+		t.Error(err)
+	} else if sk2, _ := PrivateKeyFromMnemonic(m, "x", 1); sk.String() ==
+		sk2.String() {
+		t.Error("passphrase ignored")
+	}
+}
+
+func specType(t stx.SCSpecType) (ret stx.SCSpecTypeDef) {
+	ret.Type = t
+	return
+}
+
+func testContractWasm() []byte {
+	var fn, st, un, en stx.SCSpecEntry
+	fn.Kind = stx.SC_SPEC_ENTRY_FUNCTION_V0
+	*fn.FunctionV0() = stx.SCSpecFunctionV0{
+		Name: "move_to",
+		Inputs: []stx.SCSpecFunctionInputV0{
+			{Name: "who", Type: specType(stx.SC_SPEC_TYPE_ADDRESS)},
+			{Name: "to", Type: specType(stx.SC_SPEC_TYPE_UDT)},
+			{Name: "amount", Type: specType(stx.SC_SPEC_TYPE_I128)},
+			{Name: "tags", Type: specType(stx.SC_SPEC_TYPE_VEC)},
+			{Name: "mode", Type: specType(stx.SC_SPEC_TYPE_UDT)},
+			{Name: "color", Type: specType(stx.SC_SPEC_TYPE_UDT)},
+		},
+		Outputs: []stx.SCSpecTypeDef{specType(stx.SC_SPEC_TYPE_BOOL)},
+	}
+	fn.FunctionV0().Inputs[1].Type.Udt().Name = "Point"
+	fn.FunctionV0().Inputs[3].Type.Vec().ElementType =
+		specType(stx.SC_SPEC_TYPE_SYMBOL)
+	fn.FunctionV0().Inputs[4].Type.Udt().Name = "Mode"
+	fn.FunctionV0().Inputs[5].Type.Udt().Name = "Color"
+
+	st.Kind = stx.SC_SPEC_ENTRY_UDT_STRUCT_V0
+	*st.UdtStructV0() = stx.SCSpecUDTStructV0{
+		Name: "Point",
+		Fields: []stx.SCSpecUDTStructFieldV0{
+			{Name: "y", Type: specType(stx.SC_SPEC_TYPE_U32)},
+			{Name: "x", Type: specType(stx.SC_SPEC_TYPE_U32)},
+		},
+	}
+
+	un.Kind = stx.SC_SPEC_ENTRY_UDT_UNION_V0
+	un.UdtUnionV0().Name = "Mode"
+	un.UdtUnionV0().Cases = make([]stx.SCSpecUDTUnionCaseV0, 2)
+	un.UdtUnionV0().Cases[0].Kind = stx.SC_SPEC_UDT_UNION_CASE_VOID_V0
+	un.UdtUnionV0().Cases[0].VoidCase().Name = "Walk"
+	un.UdtUnionV0().Cases[1].Kind = stx.SC_SPEC_UDT_UNION_CASE_TUPLE_V0
+	*un.UdtUnionV0().Cases[1].TupleCase() = stx.SCSpecUDTUnionCaseTupleV0{
+		Name: "Fly",
+		Type: []stx.SCSpecTypeDef{specType(stx.SC_SPEC_TYPE_U64)},
+	}
+
+	en.Kind = stx.SC_SPEC_ENTRY_UDT_ENUM_V0
+	*en.UdtEnumV0() = stx.SCSpecUDTEnumV0{
+		Name: "Color",
+		Cases: []stx.SCSpecUDTEnumCaseV0{
+			{Name: "Red", Value: 1}, {Name: "Blue", Value: 2},
+		},
+	}
+
+	payload := append([]byte{byte(len(ContractSpecSection))},
+		ContractSpecSection...)
+	payload = append(payload, stx.XdrToBytes(&fn, &st, &un, &en)...)
+	wasm := []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+	// An empty type section, which should be skipped
+	wasm = append(wasm, 1, 1, 0)
+	wasm = append(wasm, 0)
+	for n := len(payload); ; n >>= 7 {
+		if n < 0x80 {
+			wasm = append(wasm, byte(n))
+			break
+		}
+		wasm = append(wasm, byte(n&0x7f|0x80))
+	}
+	return append(wasm, payload...)
+}
+
+func TestContractSpec(t *testing.T) {
+	spec, err := ParseContractSpec(testContractWasm())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fns := spec.Functions(); len(fns) != 1 {
+		t.Fatalf("expected 1 function, got %d", len(fns))
+	} else if s := SpecFunctionString(fns[0]); s != "move_to(who: Address, "+
+		"to: Point, amount: i128, tags: Vec<Symbol>, mode: Mode, "+
+		"color: Color) -> bool" {
+		t.Errorf("bad function string %q", s)
+	}
+
+	who := "GDFR4HZMNZCNHFEIBWDQCC4JZVFQUGXUQ473EJ4SUPFOJ3XBG5DUCS2G"
+	args, err := spec.FunctionArgs("move_to", who, `{"x": 1, "y": 2}`,
+		"-5", `["a", "b"]`, `["Fly", 7]`, "Blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0].Type != stx.SCV_ADDRESS ||
+		args[0].Address().AccountId().String() != who {
+		t.Errorf("bad address %v", args[0].Type)
+	}
+	if m := **args[1].Map(); len(m) != 2 || *m[0].Key.Sym() != "x" ||
+		*m[0].Val.U32() != 1 {
+		t.Errorf("bad struct conversion")
+	}
+	if args[2].Type != stx.SCV_I128 || args[2].I128().Hi != -1 {
+		t.Errorf("bad i128 conversion")
+	}
+	if v := **args[3].Vec(); len(v) != 2 || v[1].Type != stx.SCV_SYMBOL {
+		t.Errorf("bad vec conversion")
+	}
+	if v := **args[4].Vec(); len(v) != 2 || *v[0].Sym() != "Fly" ||
+		*v[1].U64() != 7 {
+		t.Errorf("bad union conversion")
+	}
+	if *args[5].U32() != 2 {
+		t.Errorf("bad enum conversion")
+	}
+
+	if _, err = spec.FunctionArgs("move_to", who,
+		struct{ X, Y uint32 }{1, 2}, 5, []string{}, "Walk", 1); err == nil {
+		t.Error("struct with wrong field names accepted")
+	} else if serr, ok := err.(*SCValError); !ok || serr.Path != "to" {
+		t.Errorf("unexpected error %v", err)
+	}
+	type point struct {
+		X uint32 `scval:"x"`
+		Y uint32 `scval:"y"`
+	}
+	for _, bad := range [][]interface{}{
+		{who, point{1, 2}, "1.5", nil, "Walk", "Red"},
+		{who, point{1, 2}, 1, []string{"not a symbol"}, "Walk", "Red"},
+		{who, point{1, 2}, 1, nil, `["Walk", 1]`, "Red"},
+		{who, point{1, 2}, 1, nil, "Run", "Red"},
+		{who, point{1, 2}, 1, nil, "Walk", "Green"},
+		{"G", point{1, 2}, 1, nil, "Walk", "Red"},
+		{who},
+	} {
+		if _, err = spec.FunctionArgs("move_to", bad...); err == nil {
+			t.Errorf("bad arguments %v accepted", bad)
+		}
+	}
+	if op, err := spec.Invoke(stx.SCAddress{}, "move_to", who,
+		point{1, 2}, 1, []Symbol{"a"}, "Walk", 1); err != nil {
+		t.Error(err)
+	} else if op.HostFunction.InvokeContract().FunctionName != "move_to" {
+		t.Error("bad function name")
+	}
+	if _, err = spec.FunctionArgs("nosuch"); err == nil {
+		t.Error("nonexistent function accepted")
+	}
+	if _, err = ParseContractSpec([]byte("not wasm")); err == nil {
+		t.Error("invalid WASM accepted")
+	}
+}
+
+func TestSignAuthEntry(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	sk1 := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	sk2 := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	other := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+
+	authFor := func(pk stx.PublicKey) (ret stx.SorobanAuthorizationEntry) {
+		ret.Credentials.Type = stx.SOROBAN_CREDENTIALS_ADDRESS
+		addr := &ret.Credentials.Address().Address
+		addr.Type = stx.SC_ADDRESS_TYPE_ACCOUNT
+		*addr.AccountId() = pk
+		ret.RootInvocation.Function.Type =
+			stx.SOROBAN_AUTHORIZED_FUNCTION_TYPE_CONTRACT_FN
+		ret.RootInvocation.Function.ContractFn().FunctionName = "hello"
+		return
+	}
+	txe := NewTransactionEnvelope()
+	op := InvokeHostFunction{}
+	op.HostFunction.Type = stx.HOST_FUNCTION_TYPE_INVOKE_CONTRACT
+	op.Auth = []stx.SorobanAuthorizationEntry{
+		authFor(sk1.Public()), authFor(other.Public()),
+	}
+	op.Auth = append(op.Auth, stx.SorobanAuthorizationEntry{})
+	txe.Append(nil, op)
+
+	if n, err := net.SignAuthEntries(sk1, txe, 1000); err != nil || n != 1 {
+		t.Fatalf("SignAuthEntries signed %d entries (%v)", n, err)
+	}
+	auth := txe.Operations()
+	entry := &(*auth)[0].Body.InvokeHostFunctionOp().Auth[0]
+	cred := entry.Credentials.Address()
+	if cred.Nonce == 0 || cred.SignatureExpirationLedger != 1000 {
+		t.Errorf("nonce %d, expiration %d", cred.Nonce,
+			cred.SignatureExpirationLedger)
+	}
+	nonce := cred.Nonce
+	if err := net.SignAuthEntry(sk2, entry, 1000); err != nil {
+		t.Fatal(err)
+	} else if cred.Nonce != nonce {
+		t.Error("second signature changed nonce")
+	}
+
+	var sigs []accountAuthSignature
+	if err := FromSCVal(&cred.Signature, &sigs); err != nil {
+		t.Fatal(err)
+	} else if len(sigs) != 2 ||
+		bytes.Compare(sigs[0].PublicKey, sigs[1].PublicKey) >= 0 {
+		t.Fatalf("expected 2 sorted signatures, got %d", len(sigs))
+	}
+	hash := net.AuthEntryHash(entry)
+	for _, sig := range sigs {
+		var pk stx.PublicKey
+		pk.Type = stx.PUBLIC_KEY_TYPE_ED25519
+		copy(pk.Ed25519()[:], sig.PublicKey)
+		if !stcdetail.Verify(&pk, hash[:], sig.Signature) {
+			t.Errorf("bad signature by %s", pk)
+		}
+	}
+	if m := **(**cred.Signature.Vec())[0].Map(); *m[0].Key.Sym() !=
+		"public_key" || *m[1].Key.Sym() != "signature" {
+		t.Error("bad signature map")
+	}
+
+	if other := op.Auth[1].Credentials.Address(); other.Nonce != 0 ||
+		other.SignatureExpirationLedger != 0 {
+		t.Error("signed another account's entry")
+	}
+	if err := net.SignAuthEntry(sk1, &op.Auth[2], 10); err !=
+		ErrNotAddressCredentials {
+		t.Errorf("signing source account credentials gave %v", err)
+	}
+	if err := net.SignAuthEntry(sk1, entry, 2000); err != nil {
+		t.Error(err)
+	} else if FromSCVal(&cred.Signature, &sigs); len(sigs) != 1 {
+		t.Error("new expiration did not replace old signatures")
+	}
+}
+
+func TestValidateTx(t *testing.T) {
+	net := &StellarNet{NetworkId: "Stub Network ; January 2024"}
+	sk := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	issuer := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+
+	txe := NewTransactionEnvelope()
+	txe.SetSourceAccount(sk.Public())
+	txe.V1().Tx.SeqNum = 1
+	txe.Append(nil, Payment{
+		Destination: *issuer.Public().ToMuxedAccount(),
+		Asset:       MkAsset(issuer.Public(), "USD"),
+		Amount:      10000000,
+	})
+	txe.SetFee(100)
+	if bad := net.ValidateTx(txe); bad != nil {
+		t.Errorf("valid transaction has problems:\n%s", bad)
+	}
+
+	tx := &txe.V1().Tx
+	tx.SeqNum = 0
+	tx.Memo = MemoText("This memo is much too long to fit")
+	tx.Cond.Type = stx.PRECOND_V2
+	tx.Cond.V2().TimeBounds = &stx.TimeBounds{MinTime: 200, MaxTime: 100}
+	signer := stx.SignerKey{Type: stx.SIGNER_KEY_TYPE_ED25519_SIGNED_PAYLOAD}
+	pk := sk.Public()
+	signer.Ed25519SignedPayload().Ed25519 = *pk.Ed25519()
+	signer.Ed25519SignedPayload().Payload = []byte("payload")
+	tx.Cond.V2().ExtraSigners = []stx.SignerKey{signer}
+	txe.Append(nil, Payment{
+		Destination: *pk.ToMuxedAccount(),
+		Asset:       MkAsset(issuer.Public(), "US D"),
+		Amount:      10000000,
+	})
+	txe.Append(issuer.Public().ToMuxedAccount(), ChangeTrust{
+		Line: stx.ChangeTrustAsset{Type: stx.ASSET_TYPE_NATIVE},
+	})
+	sig, _ := sk.Sign([]byte("another payload"))
+	*txe.Signatures() = []stx.DecoratedSignature{{
+		Hint:      signer.Hint(),
+		Signature: sig,
+	}}
+
+	bad := net.ValidateTx(txe)
+	expected := []string{
+		"tx.fee",
+		"tx.seqNum",
+		"tx.cond.v2.extraSigners[0]",
+		"tx.cond.v2.timeBounds.minTime",
+		"tx.memo.text",
+		"tx.operations[1].body.paymentOp.destination",
+		"tx.operations[1].body.paymentOp.asset",
+		"tx.operations[2].body.changeTrustOp.line",
+	}
+	if len(bad) != len(expected) {
+		t.Fatalf("expected %d problems, got:\n%s", len(expected), bad)
+	}
+	for i := range expected {
+		if bad[i].Field != expected[i] {
+			t.Errorf("problem %d is %q, expected %q", i, bad[i].Field,
+				expected[i])
+		}
+	}
+
+	rep := net.TxToRep(txe)
+	lines := strings.Split(rep, "\n")
+	for i, te := range bad.TxrepError(strings.NewReader(rep)) {
+		if te.Line < 1 || !strings.HasPrefix(lines[te.Line-1], expected[i]) {
+			t.Errorf("%s reported at line %d", expected[i], te.Line)
+		}
+	}
+}
+
 func Example_txrep() {
 	var mykey PrivateKey
 	fmt.Sscan("SDWHLWL24OTENLATXABXY5RXBG6QFPLQU7VMKFH4RZ7EWZD2B7YRAYFS",
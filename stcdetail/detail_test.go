@@ -6,6 +6,8 @@ import (
 	. "github.com/xdrpp/stc/stcdetail"
 	"github.com/xdrpp/stc/stx"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"math/rand"
 	"os"
 	"strings"
@@ -19,6 +21,88 @@ func ExampleScaleFmt() {
 	// 98.7654321e7
 }
 
+func ExampleScaleParse() {
+	for _, s := range []string{"12.5", "12.5e7", "1,000.25", "-0.5"} {
+		v, _ := ScaleParse(s, 7)
+		fmt.Println(v)
+	}
+	_, err := ScaleParse("0.00000001", 7)
+	fmt.Println(err)
+	// Output:
+	// 125000000
+	// 125000000
+	// 10002500000
+	// -5000000
+	// "0.00000001" is not a whole number when scaled
+}
+
+func TestScaleParse(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 10000000, 987654321,
+		math.MaxInt64, math.MinInt64} {
+		if got, err := ScaleParse(ScaleFmt(v, 7), 3); err != nil || got != v {
+			t.Errorf("ScaleParse(%q) = %d, %v", ScaleFmt(v, 7), got, err)
+		}
+	}
+	for _, s := range []string{"", "e7", "1.2.3", "1,00", ",100", "12,34,567",
+		"1x", "9223372036854775808e0", "1e20", "5e-1"} {
+		if v, err := ScaleParse(s, 7); err == nil {
+			t.Errorf("ScaleParse(%q) accepted as %d", s, v)
+		}
+	}
+}
+
+func TestParseTimePoint(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	local := time.Date(2024, 1, 2, 3, 4, 0, 0, time.Local).Unix()
+	cases := []struct {
+		in  string
+		out int64
+	}{
+		{"1234", 1234},
+		{"+30m", 1700001800},
+		{"-1h", 1699996400},
+		{"+90", 1700000090},
+		{"2024-01-02T03:04:05Z", 1704164645},
+		{"2024-01-02T03:04", local},
+		{"202401020304", local},
+	}
+	for _, c := range cases {
+		if tp, err := ParseTimePoint(c.in, now); err != nil {
+			t.Errorf("ParseTimePoint(%q): %s", c.in, err)
+		} else if int64(tp) != c.out {
+			t.Errorf("ParseTimePoint(%q) = %d, want %d", c.in, tp, c.out)
+		}
+	}
+	for _, s := range []string{"", "+", "tomorrow", "1969-12-31", "+1.5s"} {
+		if _, err := ParseTimePoint(s, now); err == nil {
+			t.Errorf("ParseTimePoint(%q) should fail", s)
+		}
+	}
+
+	in := strings.NewReader(`minTime: 2024-01-02T03:04:05Z (a comment)
+maxTime: +1h
+`)
+	var tb stx.TimeBounds
+	if err := XdrFromTxrep(in, "", &tb); err != nil {
+		t.Error(err)
+	} else if tb.MinTime != 1704164645 ||
+		tb.MaxTime < stx.TimePoint(time.Now().Unix()+3599) {
+		t.Errorf("parsed %v", tb)
+	}
+
+	in = strings.NewReader("minSeqAge: 1h30m\nminSeqLedgerGap: 5\n")
+	var pc stx.PreconditionsV2
+	if err := XdrFromTxrep(in, "", &pc); err != nil {
+		t.Error(err)
+	} else if pc.MinSeqAge != 5400 {
+		t.Errorf("minSeqAge parsed as %d", pc.MinSeqAge)
+	}
+	in = strings.NewReader("minSeqAge: -1h\n")
+	if err := XdrFromTxrep(in, "", &pc); err == nil {
+		t.Error("accepted negative duration")
+	}
+}
+
 func TestJsonInt64e7Conv(t *testing.T) {
 	r := rand.New(rand.NewSource(0))
 	for i := 0; i < 10000; i++ {
@@ -220,6 +304,139 @@ func TestXdrExtract(t *testing.T) {
 	}
 }
 
+type scvalTestStruct struct {
+	Owner   stx.AccountID
+	Amount  *big.Int
+	Supply  *big.Int `scval:"supply,u256"`
+	Name    string   `scval:"name,symbol"`
+	Memo    *string
+	Tags    []Symbol
+	Data    []byte
+	Counts  map[string]uint32
+	Expires time.Time `scval:"expires"`
+	Skipped int       `scval:"-"`
+	private int
+}
+
+func TestSCVal(t *testing.T) {
+	for _, s := range []string{"-170141183460469231731687303715884105728",
+		"170141183460469231731687303715884105727", "-1", "0",
+		"18446744073709551616"} {
+		x, _ := new(big.Int).SetString(s, 10)
+		for _, ty := range []stx.SCValType{stx.SCV_I128, stx.SCV_I256} {
+			val, err := BigToSCVal(x, ty)
+			if err != nil {
+				t.Errorf("BigToSCVal(%s, %s): %s", s, ty, err)
+			} else if y := SCValToBig(&val); y.Cmp(x) != 0 {
+				t.Errorf("%s round trip through %s gave %s", s, ty, y)
+			}
+		}
+	}
+	if val, _ := BigToSCVal(big.NewInt(-2), stx.SCV_I128); val.I128().Hi != -1 ||
+		val.I128().Lo != ^uint64(1) {
+		t.Errorf("bad I128 encoding of -2: %v", *val.I128())
+	}
+	if _, err := BigToSCVal(big.NewInt(-1), stx.SCV_U256); err == nil {
+		t.Error("negative U256 should fail")
+	}
+	tooBig := new(big.Int).Lsh(big.NewInt(1), 127)
+	if _, err := BigToSCVal(tooBig, stx.SCV_I128); err == nil {
+		t.Error("2^127 should not fit in I128")
+	}
+
+	var owner stx.AccountID
+	owner.Ed25519()[0] = 1
+	in := scvalTestStruct{
+		Owner:   owner,
+		Amount:  big.NewInt(-12345),
+		Supply:  new(big.Int).Lsh(big.NewInt(1), 200),
+		Name:    "token",
+		Tags:    []Symbol{"a", "b"},
+		Data:    []byte{1, 2, 3},
+		Counts:  map[string]uint32{"z": 1, "a": 2},
+		Expires: time.Unix(1700000000, 0),
+		Skipped: 7,
+	}
+	val, err := ToSCVal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := **val.Map()
+	if len(m) != 9 {
+		t.Fatalf("expected 9 map entries, got %d", len(m))
+	}
+	for i := 1; i < len(m); i++ {
+		if CompareSCVal(&m[i-1].Key, &m[i].Key) >= 0 {
+			t.Errorf("map keys out of order: %s, %s",
+				*m[i-1].Key.Sym(), *m[i].Key.Sym())
+		}
+	}
+	for _, e := range m {
+		switch *e.Key.Sym() {
+		case "supply":
+			if e.Val.Type != stx.SCV_U256 {
+				t.Errorf("supply has type %s", e.Val.Type)
+			}
+		case "name":
+			if e.Val.Type != stx.SCV_SYMBOL {
+				t.Errorf("name has type %s", e.Val.Type)
+			}
+		case "Memo":
+			if e.Val.Type != stx.SCV_VOID {
+				t.Errorf("Memo has type %s", e.Val.Type)
+			}
+		case "Counts":
+			if c := **e.Val.Map(); *c[0].Key.Str() != "a" {
+				t.Errorf("Counts not sorted")
+			}
+		}
+	}
+
+	var out scvalTestStruct
+	if err = FromSCVal(&val, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Amount.Cmp(in.Amount) != 0 || out.Supply.Cmp(in.Supply) != 0 ||
+		out.Name != in.Name || out.Memo != nil || len(out.Tags) != 2 ||
+		string(out.Data) != string(in.Data) || out.Counts["a"] != 2 ||
+		!out.Expires.Equal(in.Expires) || out.Owner != in.Owner ||
+		out.Skipped != 0 {
+		t.Errorf("round trip mismatch: %+v", out)
+	}
+
+	var generic interface{}
+	if err = FromSCVal(&val, &generic); err != nil {
+		t.Fatal(err)
+	} else if gm, ok := generic.(map[interface{}]interface{}); !ok {
+		t.Errorf("generic conversion gave %T", generic)
+	} else if gm[Symbol("name")] != Symbol("token") {
+		t.Errorf("generic name is %v", gm[Symbol("name")])
+	}
+
+	var partial struct{ Name string }
+	err = FromSCVal(&val, &partial)
+	if serr, ok := err.(*SCValError); !ok {
+		t.Errorf("expected SCValError, got %v", err)
+	} else if !strings.Contains(serr.Msg, "no field") {
+		t.Errorf("unexpected error %s", serr)
+	}
+	var amt struct{ Amount int8 }
+	v2, _ := ToSCVal(struct{ Amount int64 }{1000})
+	if err = FromSCVal(&v2, &amt); err == nil ||
+		err.(*SCValError).Path != ".Amount" {
+		t.Errorf("expected range error at .Amount, got %v", err)
+	}
+	if _, err = ToSCVal(Symbol("not a symbol")); err == nil {
+		t.Error("invalid symbol accepted")
+	}
+	if _, err = ToSCVal(map[Symbol]int{"x": 1, "y": 2}); err != nil {
+		t.Error(err)
+	}
+	if _, err = ToSCVal(make(chan int)); err == nil {
+		t.Error("channel accepted")
+	}
+}
+
 func TestFileChanged(t *testing.T) {
 	fi1, e := os.Stat("/etc/fstab")
 	if e != nil {
@@ -327,3 +544,36 @@ func ExampleGetTxrepField() {
 	// tx.ext.v: 0
 	// signatures.len: 0
 }
+
+func TestMnemonic(t *testing.T) {
+	for _, n := range []int{16, 20, 24, 28, 32} {
+		entropy := make([]byte, n)
+		rand.Read(entropy)
+		m := EntropyToMnemonic(entropy)
+		if got, err := MnemonicToEntropy(strings.ToUpper(m)); err != nil {
+			t.Errorf("%s: %s", m, err)
+		} else if fmt.Sprintf("%x", got) != fmt.Sprintf("%x", entropy) {
+			t.Errorf("%s: entropy %x != %x", m, got, entropy)
+		} else if len(strings.Fields(m)) != n*3/4 {
+			t.Errorf("%s: wrong number of words", m)
+		}
+	}
+
+	m := EntropyToMnemonic(make([]byte, 16))
+	if m != strings.Repeat("abandon ", 11)+"about" {
+		t.Errorf("bad mnemonic for zero entropy: %s", m)
+	} else if seed := MnemonicSeed(m, "TREZOR"); fmt.Sprintf("%x", seed) !=
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e5349553"+
+			"1f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" {
+		t.Errorf("bad seed %x", seed)
+	}
+	for _, bad := range []string{
+		strings.Repeat("abandon ", 12),
+		strings.Repeat("abandon ", 10) + "about",
+		strings.Repeat("abandon ", 11) + "aboot",
+	} {
+		if _, err := MnemonicToEntropy(bad); err == nil {
+			t.Errorf("accepted invalid mnemonic %q", bad)
+		}
+	}
+}
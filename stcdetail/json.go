@@ -1,7 +1,6 @@
 package stcdetail
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -44,34 +43,18 @@ func (i JsonInt64e7) String() string {
 }
 
 func (i JsonInt64e7) MarshalText() ([]byte, error) {
-	if i >= 0 {
-		return []byte(fmt.Sprintf("%d.%07d", int64(i)/10000000,
-			int64(i)%10000000)), nil
-	} else {
-		return []byte(fmt.Sprintf("%d.%07d", int64(i)/10000000,
-			-(int64(i) % 10000000))), nil
+	mag, sign := uint64(i), ""
+	if i < 0 {
+		mag, sign = uint64(-i), "-"
 	}
+	return []byte(fmt.Sprintf("%s%d.%07d", sign, mag/10000000,
+		mag%10000000)), nil
 }
 
 func (i *JsonInt64e7) UnmarshalText(text []byte) error {
-	frac := []byte("0")
-	if point := bytes.IndexByte(text, '.'); point >= 0 {
-		frac = text[point+1:]
-		text = text[:point]
-		if len(frac) < 7 {
-			frac = append(frac, bytes.Repeat([]byte{'0'}, 7-len(frac))...)
-		} else {
-			frac = frac[:7]
-		}
+	v, err := ScaleParse(string(text), 7)
+	if err == nil {
+		*i = JsonInt64e7(v)
 	}
-	if left, err := strconv.ParseInt(string(text), 10, 64); err != nil {
-		return err
-	} else if right, err := strconv.ParseInt(string(frac), 10, 64); err != nil {
-		return err
-	} else if left >= 0 {
-		*i = JsonInt64e7(left*10000000 + right)
-	} else {
-		*i = JsonInt64e7(left*10000000 - right)
-	}
-	return nil
+	return err
 }
@@ -0,0 +1,99 @@
+package stcdetail
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"sort"
+	"strings"
+)
+
+// Error returned for an invalid BIP-39 mnemonic.
+type ErrMnemonic string
+
+func (e ErrMnemonic) Error() string {
+	return "invalid mnemonic: " + string(e)
+}
+
+// Encode entropy as a BIP-39 mnemonic using the English wordlist.
+// The entropy must be 16, 20, 24, 28, or 32 bytes, yielding 12, 15,
+// 18, 21, or 24 words respectively.
+func EntropyToMnemonic(entropy []byte) string {
+	n := len(entropy)
+	if n < 16 || n > 32 || n%4 != 0 {
+		panic(fmt.Sprintf("EntropyToMnemonic: invalid entropy length %d", n))
+	}
+	h := sha256.Sum256(entropy)
+	bits := append(append([]byte{}, entropy...), h[0])
+	words := make([]string, n*3/4)
+	for i := range words {
+		idx := 0
+		for j := i * 11; j < (i+1)*11; j++ {
+			idx = idx<<1 | int(bits[j/8]>>(7-j%8)&1)
+		}
+		words[i] = bip39English[idx]
+	}
+	return strings.Join(words, " ")
+}
+
+// Decode a BIP-39 mnemonic in the English wordlist, checking its
+// checksum.  Words may be separated by any whitespace and are not
+// case-sensitive.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	nw := len(words)
+	if nw < 12 || nw > 24 || nw%3 != 0 {
+		return nil, ErrMnemonic(fmt.Sprintf(
+			"%d words (must be 12, 15, 18, 21, or 24)", nw))
+	}
+	bits := make([]byte, (nw*11+7)/8)
+	for i, w := range words {
+		idx := sort.SearchStrings(bip39English, w)
+		if idx == len(bip39English) || bip39English[idx] != w {
+			return nil, ErrMnemonic(fmt.Sprintf("unknown word %q", w))
+		}
+		for j := 0; j < 11; j++ {
+			if idx&(1<<(10-j)) != 0 {
+				bit := i*11 + j
+				bits[bit/8] |= 0x80 >> (bit % 8)
+			}
+		}
+	}
+	n := nw * 4 / 3
+	h := sha256.Sum256(bits[:n])
+	if (bits[n]^h[0])>>(8-n/4) != 0 {
+		return nil, ErrMnemonic("bad checksum")
+	}
+	return bits[:n], nil
+}
+
+// Compute the BIP-39 seed of a mnemonic and optional passphrase.  The
+// words are joined by single spaces, but no Unicode normalization is
+// applied, so a non-ASCII passphrase must already be in NFKD form.
+func MnemonicSeed(mnemonic, passphrase string) []byte {
+	return pbkdf2.Key([]byte(strings.Join(strings.Fields(mnemonic), " ")),
+		[]byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+// Derive an ed25519 key from a seed following SLIP-0010.  Since
+// SLIP-0010 only supports hardened derivation for ed25519, every
+// element of path is hardened (i.e., has 0x80000000 added), so that
+// path 44, 148, 0 means m/44'/148'/0'.
+func SLIP10Ed25519(seed []byte, path ...uint32) Ed25519Priv {
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	for _, idx := range path {
+		var data [37]byte
+		copy(data[1:33], i[:32])
+		binary.BigEndian.PutUint32(data[33:], idx|0x80000000)
+		mac = hmac.New(sha512.New, i[32:])
+		mac.Write(data[:])
+		i = mac.Sum(nil)
+	}
+	return Ed25519Priv(ed25519.NewKeyFromSeed(i[:32]))
+}
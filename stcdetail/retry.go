@@ -0,0 +1,139 @@
+package stcdetail
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Implementation of stc.IsTemporary, which see.
+func IsTemporary(err error) bool {
+	dial_not_dns := false
+	for ; err != nil; err = errors.Unwrap(err) {
+		if t, ok := err.(interface{ Temporary() bool }); ok && t.Temporary() {
+			return true
+		} else if operr, ok := err.(*net.OpError); ok && operr.Op == "dial" {
+			dial_not_dns = true
+		} else if _, ok := err.(*net.DNSError); ok {
+			dial_not_dns = false
+		}
+	}
+	return dial_not_dns
+}
+
+// If err wraps an HTTPerror whose response has a Retry-After header,
+// returns the delay the server requested.
+func RetryAfter(err error) (time.Duration, bool) {
+	var herr *HTTPerror
+	if !errors.As(err, &herr) || herr.Resp == nil {
+		return 0, false
+	}
+	ra := herr.Resp.Header.Get("Retry-After")
+	if ra == "" {
+		return 0, false
+	} else if secs, err := strconv.ParseUint(ra, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second, true
+	} else if t, err := http.ParseTime(ra); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Specifies how to retry failed requests.  A nil *RetryPolicy or
+// the zero value makes only a single attempt.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// Delay before the first retry.  The delay doubles after each
+	// subsequent attempt, up to MaxDelay (if MaxDelay is non-zero).
+	// Requests whose Retry-After header asks for a longer wait than
+	// MaxDelay are not retried.
+	MinDelay, MaxDelay time.Duration
+
+	// Fraction of each delay to randomize, between 0 and 1.  For
+	// example, with 0.25 the actual delay is between 75% and 100% of
+	// the computed one.  This keeps many clients from retrying in
+	// lock step.
+	Jitter float64
+
+	// Returns true if a request that failed with a particular error
+	// should be retried.  If nil, uses IsTemporary.
+	Retryable func(error) bool
+}
+
+// Returns the time to wait after attempt number attempt (starting
+// from 1) fails with err.  A Retry-After header in err takes
+// precedence over the exponential backoff, but is still limited to
+// MaxDelay.
+func (p *RetryPolicy) Delay(attempt int, err error) time.Duration {
+	if d, ok := RetryAfter(err); ok {
+		if p.MaxDelay != 0 && d > p.MaxDelay {
+			d = p.MaxDelay
+		}
+		return d
+	}
+	d := p.MinDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay != 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// Called after attempt number attempt (starting from 1) fails with
+// err.  If the request should be retried, waits for the appropriate
+// delay and returns true.  Returns false if the error is not
+// retryable, there have been too many attempts, the server asked to
+// wait longer than MaxDelay, or ctx (which may be nil) is done.
+func (p *RetryPolicy) Wait(ctx context.Context, attempt int,
+	err error) bool {
+	if p == nil || attempt >= p.MaxAttempts ||
+		ctx != nil && ctx.Err() != nil {
+		return false
+	} else if d, ok := RetryAfter(err); ok && p.MaxDelay != 0 &&
+		d > p.MaxDelay {
+		return false
+	} else if retryable := p.Retryable; retryable == nil {
+		if !IsTemporary(err) {
+			return false
+		}
+	} else if !retryable(err) {
+		return false
+	}
+	d := p.Delay(attempt, err)
+	if ctx == nil {
+		time.Sleep(d)
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Calls fn until it returns nil or Wait returns false, and returns
+// the last error.
+func (p *RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := fn(); err == nil || !p.Wait(ctx, attempt, err) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,822 @@
+package stcdetail
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/xdrpp/stc/stx"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A string that converts to an SCVal of type SCV_SYMBOL rather than
+// SCV_STRING.
+type Symbol string
+
+// Error converting between a Go value and an SCVal.
+type SCValError struct {
+	// Location of the problem within the value, such as ".Amount[2]",
+	// or empty for the top-level value.
+	Path string
+	Msg  string
+}
+
+func (e *SCValError) Error() string {
+	if e.Path == "" {
+		return "SCVal conversion: " + e.Msg
+	}
+	return "SCVal conversion at " + e.Path + ": " + e.Msg
+}
+
+func scvalErr(path string, format string, args ...interface{}) error {
+	return &SCValError{Path: path, Msg: fmt.Sprintf(format, args...)}
+}
+
+const noHint = stx.SCValType(-1)
+
+var scvalHints = map[string]stx.SCValType{
+	"symbol":    stx.SCV_SYMBOL,
+	"string":    stx.SCV_STRING,
+	"bytes":     stx.SCV_BYTES,
+	"u32":       stx.SCV_U32,
+	"i32":       stx.SCV_I32,
+	"u64":       stx.SCV_U64,
+	"i64":       stx.SCV_I64,
+	"u128":      stx.SCV_U128,
+	"i128":      stx.SCV_I128,
+	"u256":      stx.SCV_U256,
+	"i256":      stx.SCV_I256,
+	"timepoint": stx.SCV_TIMEPOINT,
+	"duration":  stx.SCV_DURATION,
+}
+
+var (
+	scvalType     = reflect.TypeOf(stx.SCVal{})
+	bigIntType    = reflect.TypeOf(big.Int{})
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	scAddressType = reflect.TypeOf(stx.SCAddress{})
+	accountIDType = reflect.TypeOf(stx.AccountID{})
+	symbolType    = reflect.TypeOf(Symbol(""))
+)
+
+// Returns an error if s is not a valid Soroban symbol.
+func CheckSymbol(s string) error {
+	if len(s) > stx.SCSYMBOL_LIMIT {
+		return fmt.Errorf("symbol %q longer than %d characters",
+			s, stx.SCSYMBOL_LIMIT)
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c == '_' || c >= '0' && c <= '9' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return fmt.Errorf("invalid character %q in symbol %q", c, s)
+		}
+	}
+	return nil
+}
+
+// Parses a struct field's scval tag, which has the form
+// `scval:"name,type"`, where both parts are optional, name "-" skips
+// the field, and type is one of the keys of scvalHints.  Returns ok
+// false if the field should be skipped.
+func scvalField(f *reflect.StructField) (name string, hint stx.SCValType,
+	ok bool, err error) {
+	if f.PkgPath != "" {
+		return "", noHint, false, nil
+	}
+	name, hint = f.Name, noHint
+	tag := f.Tag.Get("scval")
+	if tag == "-" {
+		return "", noHint, false, nil
+	}
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		h, found := scvalHints[tag[i+1:]]
+		if !found {
+			return "", noHint, false,
+				fmt.Errorf("unknown type %q in scval tag", tag[i+1:])
+		}
+		hint, tag = h, tag[:i]
+	}
+	if tag != "" {
+		name = tag
+	}
+	if err = CheckSymbol(name); err != nil {
+		return "", noHint, false, err
+	}
+	return name, hint, true, nil
+}
+
+// Returns true if x fits in an integer of the given number of bits.
+func bigFits(x *big.Int, bits uint, signed bool) bool {
+	if signed {
+		lim := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		return x.Cmp(lim) < 0 && x.Cmp(lim.Neg(lim)) >= 0
+	}
+	return x.Sign() >= 0 && uint(x.BitLen()) <= bits
+}
+
+// Splits x into 64-bit two's complement words, most significant
+// first.  x must fit in 64*len(words) bits.
+func bigToWords(x *big.Int, words []uint64) {
+	bits := uint(64 * len(words))
+	u := new(big.Int).Set(x)
+	if u.Sign() < 0 {
+		u.Add(u, new(big.Int).Lsh(big.NewInt(1), bits))
+	}
+	mask := new(big.Int).SetUint64(^uint64(0))
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = new(big.Int).And(u, mask).Uint64()
+		u.Rsh(u, 64)
+	}
+}
+
+// Inverse of bigToWords.
+func wordsToBig(signed bool, words ...uint64) *big.Int {
+	ret := new(big.Int)
+	for _, w := range words {
+		ret.Lsh(ret, 64)
+		ret.Or(ret, new(big.Int).SetUint64(w))
+	}
+	if bits := uint(64 * len(words)); signed && ret.Bit(int(bits-1)) != 0 {
+		ret.Sub(ret, new(big.Int).Lsh(big.NewInt(1), bits))
+	}
+	return ret
+}
+
+// Converts an integer to an SCVal of type t, which must be one of the
+// integer types (including SCV_TIMEPOINT and SCV_DURATION).
+func BigToSCVal(x *big.Int, t stx.SCValType) (ret stx.SCVal, err error) {
+	var bits uint
+	signed := false
+	switch t {
+	case stx.SCV_I32, stx.SCV_I64, stx.SCV_I128, stx.SCV_I256:
+		signed = true
+	}
+	switch t {
+	case stx.SCV_U32, stx.SCV_I32:
+		bits = 32
+	case stx.SCV_U64, stx.SCV_I64, stx.SCV_TIMEPOINT, stx.SCV_DURATION:
+		bits = 64
+	case stx.SCV_U128, stx.SCV_I128:
+		bits = 128
+	case stx.SCV_U256, stx.SCV_I256:
+		bits = 256
+	default:
+		return ret, fmt.Errorf("cannot convert integer to %s", t)
+	}
+	if !bigFits(x, bits, signed) {
+		return ret, fmt.Errorf("integer %s out of range for %s", x, t)
+	}
+	var w [4]uint64
+	bigToWords(x, w[:(bits+63)/64])
+	ret.Type = t
+	switch t {
+	case stx.SCV_U32:
+		*ret.U32() = uint32(w[0])
+	case stx.SCV_I32:
+		*ret.I32() = int32(w[0])
+	case stx.SCV_U64:
+		*ret.U64() = w[0]
+	case stx.SCV_I64:
+		*ret.I64() = int64(w[0])
+	case stx.SCV_TIMEPOINT:
+		*ret.Timepoint() = w[0]
+	case stx.SCV_DURATION:
+		*ret.Duration() = w[0]
+	case stx.SCV_U128:
+		*ret.U128() = stx.UInt128Parts{Hi: w[0], Lo: w[1]}
+	case stx.SCV_I128:
+		*ret.I128() = stx.Int128Parts{Hi: int64(w[0]), Lo: w[1]}
+	case stx.SCV_U256:
+		*ret.U256() = stx.UInt256Parts{
+			Hi_hi: w[0], Hi_lo: w[1], Lo_hi: w[2], Lo_lo: w[3]}
+	case stx.SCV_I256:
+		*ret.I256() = stx.Int256Parts{
+			Hi_hi: int64(w[0]), Hi_lo: w[1], Lo_hi: w[2], Lo_lo: w[3]}
+	}
+	return ret, nil
+}
+
+// Returns the value of an integer SCVal (including SCV_TIMEPOINT and
+// SCV_DURATION), or nil if val is not an integer.
+func SCValToBig(val *stx.SCVal) *big.Int {
+	switch val.Type {
+	case stx.SCV_U32:
+		return new(big.Int).SetUint64(uint64(*val.U32()))
+	case stx.SCV_I32:
+		return big.NewInt(int64(*val.I32()))
+	case stx.SCV_U64:
+		return new(big.Int).SetUint64(*val.U64())
+	case stx.SCV_I64:
+		return big.NewInt(*val.I64())
+	case stx.SCV_TIMEPOINT:
+		return new(big.Int).SetUint64(*val.Timepoint())
+	case stx.SCV_DURATION:
+		return new(big.Int).SetUint64(*val.Duration())
+	case stx.SCV_U128:
+		p := val.U128()
+		return wordsToBig(false, p.Hi, p.Lo)
+	case stx.SCV_I128:
+		p := val.I128()
+		return wordsToBig(true, uint64(p.Hi), p.Lo)
+	case stx.SCV_U256:
+		p := val.U256()
+		return wordsToBig(false, p.Hi_hi, p.Hi_lo, p.Lo_hi, p.Lo_lo)
+	case stx.SCV_I256:
+		p := val.I256()
+		return wordsToBig(true, uint64(p.Hi_hi), p.Hi_lo, p.Lo_hi, p.Lo_lo)
+	}
+	return nil
+}
+
+func scvalVec(val *stx.SCVal) stx.SCVec {
+	if v := *val.Vec(); v != nil {
+		return *v
+	}
+	return nil
+}
+
+func scvalMap(val *stx.SCVal) stx.SCMap {
+	if m := *val.Map(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+func cmpInt(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compares two SCVals in the order Soroban requires for map keys:
+// first by type, then by value.
+func CompareSCVal(a, b *stx.SCVal) int {
+	if a.Type != b.Type {
+		return cmpInt(int(a.Type), int(b.Type))
+	} else if x := SCValToBig(a); x != nil {
+		return x.Cmp(SCValToBig(b))
+	}
+	switch a.Type {
+	case stx.SCV_BOOL:
+		x, y := 0, 0
+		if *a.B() {
+			x = 1
+		}
+		if *b.B() {
+			y = 1
+		}
+		return cmpInt(x, y)
+	case stx.SCV_STRING:
+		return strings.Compare(*a.Str(), *b.Str())
+	case stx.SCV_SYMBOL:
+		return strings.Compare(*a.Sym(), *b.Sym())
+	case stx.SCV_BYTES:
+		return bytes.Compare(*a.Bytes(), *b.Bytes())
+	case stx.SCV_VEC:
+		x, y := scvalVec(a), scvalVec(b)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := CompareSCVal(&x[i], &y[i]); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(len(x), len(y))
+	case stx.SCV_MAP:
+		x, y := scvalMap(a), scvalMap(b)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := CompareSCVal(&x[i].Key, &y[i].Key); c != 0 {
+				return c
+			} else if c = CompareSCVal(&x[i].Val, &y[i].Val); c != 0 {
+				return c
+			}
+		}
+		return cmpInt(len(x), len(y))
+	}
+	return strings.Compare(XdrToBin(a), XdrToBin(b))
+}
+
+// Describes an SCVal for use in error messages.
+func scvalString(val *stx.SCVal) string {
+	if x, err := scvalNatural(val, ""); err == nil {
+		switch x.(type) {
+		case stx.SCVal, stx.SCAddress, []interface{},
+			map[interface{}]interface{}:
+		default:
+			return fmt.Sprintf("%v", x)
+		}
+	}
+	return val.Type.String()
+}
+
+// Sorts map entries by key, as Soroban requires, and rejects
+// duplicate keys.
+func SortSCMap(m stx.SCMap) error {
+	sort.SliceStable(m, func(i, j int) bool {
+		return CompareSCVal(&m[i].Key, &m[j].Key) < 0
+	})
+	for i := 1; i < len(m); i++ {
+		if CompareSCVal(&m[i-1].Key, &m[i].Key) == 0 {
+			return fmt.Errorf("duplicate map key %s", scvalString(&m[i].Key))
+		}
+	}
+	return nil
+}
+
+// Converts a Go value to an SCVal.  The conversion is as follows:
+//
+// * nil pointers and interfaces become SCV_VOID; other pointers are
+// followed (so a pointer can represent a Soroban Option).
+//
+// * bool becomes SCV_BOOL.
+//
+// * Signed integers become SCV_I32 or SCV_I64 and unsigned integers
+// SCV_U32 or SCV_U64, depending on their size.  big.Int becomes
+// SCV_I128.
+//
+// * time.Time becomes SCV_TIMEPOINT and time.Duration SCV_DURATION
+// (which must be a non-negative whole number of seconds).
+//
+// * string becomes SCV_STRING, and Symbol SCV_SYMBOL.
+//
+// * []byte and byte arrays become SCV_BYTES.
+//
+// * stx.SCAddress and stx.AccountID become SCV_ADDRESS.
+//
+// * Other slices and arrays become SCV_VEC.
+//
+// * Maps become SCV_MAP, with the entries sorted by key.
+//
+// * Structs become SCV_MAP, keyed by symbols with the names of the
+// exported fields, as Soroban represents contract types.  A field tag
+// `scval:"name,type"` changes the key to name and the SCVal type of
+// the field (or of its elements, if it is a slice) to type, which is
+// one of symbol, string, bytes, u32, i32, u64, i64, u128, i128, u256,
+// i256, timepoint, or duration.  Tag "-" omits the field.
+//
+// * stx.SCVal is copied unchanged.
+//
+// Errors are of type *SCValError.
+func ToSCVal(v interface{}) (stx.SCVal, error) {
+	return toSCVal(reflect.ValueOf(v), noHint, "")
+}
+
+func toSCVal(v reflect.Value, hint stx.SCValType,
+	path string) (ret stx.SCVal, err error) {
+	if !v.IsValid() {
+		ret.Type = stx.SCV_VOID
+		return
+	}
+
+	switch v.Type() {
+	case scvalType:
+		return v.Interface().(stx.SCVal), nil
+	case bigIntType:
+		var x big.Int
+		if v.CanAddr() {
+			x.Set(v.Addr().Interface().(*big.Int))
+		} else {
+			x = v.Interface().(big.Int)
+		}
+		if hint == noHint {
+			hint = stx.SCV_I128
+		}
+		if ret, err = BigToSCVal(&x, hint); err != nil {
+			err = scvalErr(path, "%s", err)
+		}
+		return
+	case timeType:
+		t := v.Interface().(time.Time)
+		if t.Unix() < 0 {
+			return ret, scvalErr(path, "time %s before 1970", t)
+		} else if hint != noHint && hint != stx.SCV_TIMEPOINT {
+			return ret, scvalErr(path, "cannot convert time to %s", hint)
+		}
+		ret.Type = stx.SCV_TIMEPOINT
+		*ret.Timepoint() = uint64(t.Unix())
+		return
+	case durationType:
+		d := v.Interface().(time.Duration)
+		if d < 0 || d%time.Second != 0 {
+			return ret, scvalErr(path,
+				"duration %s not a whole number of seconds", d)
+		} else if hint != noHint && hint != stx.SCV_DURATION {
+			return ret, scvalErr(path,
+				"cannot convert duration to %s", hint)
+		}
+		ret.Type = stx.SCV_DURATION
+		*ret.Duration() = uint64(d / time.Second)
+		return
+	case scAddressType:
+		ret.Type = stx.SCV_ADDRESS
+		*ret.Address() = v.Interface().(stx.SCAddress)
+		return
+	case accountIDType:
+		ret.Type = stx.SCV_ADDRESS
+		ret.Address().Type = stx.SC_ADDRESS_TYPE_ACCOUNT
+		*ret.Address().AccountId() = v.Interface().(stx.AccountID)
+		return
+	case symbolType:
+		hint = stx.SCV_SYMBOL
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			ret.Type = stx.SCV_VOID
+			return
+		}
+		return toSCVal(v.Elem(), hint, path)
+	case reflect.Bool:
+		ret.Type = stx.SCV_BOOL
+		*ret.B() = v.Bool()
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		if hint == noHint {
+			if hint = stx.SCV_I64; v.Type().Bits() <= 32 {
+				hint = stx.SCV_I32
+			}
+		}
+		if ret, err = BigToSCVal(big.NewInt(v.Int()), hint); err != nil {
+			err = scvalErr(path, "%s", err)
+		}
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if hint == noHint {
+			if hint = stx.SCV_U64; v.Type().Bits() <= 32 {
+				hint = stx.SCV_U32
+			}
+		}
+		ret, err = BigToSCVal(new(big.Int).SetUint64(v.Uint()), hint)
+		if err != nil {
+			err = scvalErr(path, "%s", err)
+		}
+		return
+	case reflect.String:
+		switch hint {
+		case noHint, stx.SCV_STRING:
+			ret.Type = stx.SCV_STRING
+			*ret.Str() = v.String()
+		case stx.SCV_SYMBOL:
+			if err = CheckSymbol(v.String()); err != nil {
+				return ret, scvalErr(path, "%s", err)
+			}
+			ret.Type = stx.SCV_SYMBOL
+			*ret.Sym() = v.String()
+		default:
+			err = scvalErr(path, "cannot convert string to %s", hint)
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 &&
+			(hint == noHint || hint == stx.SCV_BYTES) {
+			ret.Type = stx.SCV_BYTES
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			*ret.Bytes() = b
+			return
+		}
+		vec := make(stx.SCVec, v.Len())
+		for i := range vec {
+			vec[i], err = toSCVal(v.Index(i), hint,
+				fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return
+			}
+		}
+		ret.Type = stx.SCV_VEC
+		*ret.Vec() = &vec
+		return
+	case reflect.Map:
+		m := make(stx.SCMap, 0, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			var e stx.SCMapEntry
+			kpath := fmt.Sprintf("%s[%v]", path, it.Key())
+			if e.Key, err = toSCVal(it.Key(), noHint, kpath); err != nil {
+				return
+			} else if e.Val, err = toSCVal(it.Value(), hint,
+				kpath); err != nil {
+				return
+			}
+			m = append(m, e)
+		}
+		if err = SortSCMap(m); err != nil {
+			return ret, scvalErr(path, "%s", err)
+		}
+		ret.Type = stx.SCV_MAP
+		*ret.Map() = &m
+		return
+	case reflect.Struct:
+		t := v.Type()
+		m := make(stx.SCMap, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fpath := path + "." + f.Name
+			name, fhint, ok, ferr := scvalField(&f)
+			if ferr != nil {
+				return ret, scvalErr(fpath, "%s", ferr)
+			} else if !ok {
+				continue
+			}
+			var e stx.SCMapEntry
+			e.Key.Type = stx.SCV_SYMBOL
+			*e.Key.Sym() = name
+			if e.Val, err = toSCVal(v.Field(i), fhint, fpath); err != nil {
+				return
+			}
+			m = append(m, e)
+		}
+		if err = SortSCMap(m); err != nil {
+			return ret, scvalErr(path, "%s", err)
+		}
+		ret.Type = stx.SCV_MAP
+		*ret.Map() = &m
+		return
+	}
+	return ret, scvalErr(path, "cannot convert Go type %s to SCVal",
+		v.Type())
+}
+
+// Converts an SCVal to a Go value, storing the result in out, which
+// must be a non-nil pointer.  This is the inverse of ToSCVal, except
+// that integer and string types accept any SCVal whose value fits,
+// and struct fields absent from the SCV_MAP are left unchanged.  If
+// out points to an empty interface, stores a bool, uint32, int32,
+// uint64, int64, *big.Int, time.Time, time.Duration, []byte, string,
+// Symbol, stx.SCAddress, []interface{}, map[interface{}]interface{},
+// or (for other types of SCVal) stx.SCVal.  Errors are of type
+// *SCValError.
+func FromSCVal(val *stx.SCVal, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return scvalErr("", "FromSCVal requires a non-nil pointer, not %T",
+			out)
+	}
+	return fromSCVal(val, v.Elem(), "")
+}
+
+func wrongSCVal(val *stx.SCVal, t reflect.Type, path string) error {
+	return scvalErr(path, "cannot convert %s to Go type %s", val.Type, t)
+}
+
+// Returns the Go value FromSCVal stores in an empty interface.
+func scvalNatural(val *stx.SCVal, path string) (interface{}, error) {
+	switch val.Type {
+	case stx.SCV_VOID:
+		return nil, nil
+	case stx.SCV_BOOL:
+		return *val.B(), nil
+	case stx.SCV_U32:
+		return *val.U32(), nil
+	case stx.SCV_I32:
+		return *val.I32(), nil
+	case stx.SCV_U64:
+		return *val.U64(), nil
+	case stx.SCV_I64:
+		return *val.I64(), nil
+	case stx.SCV_TIMEPOINT:
+		return time.Unix(int64(*val.Timepoint()), 0), nil
+	case stx.SCV_DURATION:
+		return time.Duration(*val.Duration()) * time.Second, nil
+	case stx.SCV_U128, stx.SCV_I128, stx.SCV_U256, stx.SCV_I256:
+		return SCValToBig(val), nil
+	case stx.SCV_BYTES:
+		return append([]byte{}, *val.Bytes()...), nil
+	case stx.SCV_STRING:
+		return *val.Str(), nil
+	case stx.SCV_SYMBOL:
+		return Symbol(*val.Sym()), nil
+	case stx.SCV_ADDRESS:
+		return *val.Address(), nil
+	case stx.SCV_VEC:
+		vec := scvalVec(val)
+		ret := make([]interface{}, len(vec))
+		for i := range vec {
+			var err error
+			ret[i], err = scvalNatural(&vec[i],
+				fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case stx.SCV_MAP:
+		ret := make(map[interface{}]interface{})
+		for _, e := range scvalMap(val) {
+			kpath := fmt.Sprintf("%s[%s]", path, scvalString(&e.Key))
+			k, err := scvalNatural(&e.Key, kpath)
+			if err != nil {
+				return nil, err
+			} else if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, scvalErr(kpath,
+					"%s cannot be a Go map key", e.Key.Type)
+			} else if _, ok := k.(*big.Int); ok {
+				return nil, scvalErr(kpath,
+					"%s cannot be a Go map key", e.Key.Type)
+			}
+			if ret[k], err = scvalNatural(&e.Val, kpath); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	}
+	return *val, nil
+}
+
+func fromSCVal(val *stx.SCVal, v reflect.Value, path string) error {
+	t := v.Type()
+	switch t {
+	case scvalType:
+		v.Set(reflect.ValueOf(*val))
+		return nil
+	case bigIntType:
+		x := SCValToBig(val)
+		if x == nil {
+			return wrongSCVal(val, t, path)
+		}
+		v.Addr().Interface().(*big.Int).Set(x)
+		return nil
+	case timeType:
+		if val.Type != stx.SCV_TIMEPOINT {
+			return wrongSCVal(val, t, path)
+		}
+		v.Set(reflect.ValueOf(time.Unix(int64(*val.Timepoint()), 0)))
+		return nil
+	case durationType:
+		if val.Type != stx.SCV_DURATION {
+			return wrongSCVal(val, t, path)
+		} else if *val.Duration() > uint64(1<<63-1)/uint64(time.Second) {
+			return scvalErr(path, "duration %d seconds out of range",
+				*val.Duration())
+		}
+		v.SetInt(int64(*val.Duration()) * int64(time.Second))
+		return nil
+	case scAddressType:
+		if val.Type != stx.SCV_ADDRESS {
+			return wrongSCVal(val, t, path)
+		}
+		v.Set(reflect.ValueOf(*val.Address()))
+		return nil
+	case accountIDType:
+		if val.Type != stx.SCV_ADDRESS ||
+			val.Address().Type != stx.SC_ADDRESS_TYPE_ACCOUNT {
+			return wrongSCVal(val, t, path)
+		}
+		v.Set(reflect.ValueOf(*val.Address().AccountId()))
+		return nil
+	case symbolType:
+		if val.Type != stx.SCV_SYMBOL {
+			return wrongSCVal(val, t, path)
+		}
+		v.SetString(*val.Sym())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			break
+		}
+		x, err := scvalNatural(val, path)
+		if err != nil {
+			return err
+		} else if x == nil {
+			v.Set(reflect.Zero(t))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Ptr:
+		if val.Type == stx.SCV_VOID {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		p := reflect.New(t.Elem())
+		if err := fromSCVal(val, p.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	case reflect.Bool:
+		if val.Type != stx.SCV_BOOL {
+			return wrongSCVal(val, t, path)
+		}
+		v.SetBool(*val.B())
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		x := SCValToBig(val)
+		if x == nil {
+			return wrongSCVal(val, t, path)
+		} else if !bigFits(x, uint(t.Bits()), true) {
+			return scvalErr(path, "%s %s out of range for Go type %s",
+				val.Type, x, t)
+		}
+		v.SetInt(x.Int64())
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		x := SCValToBig(val)
+		if x == nil {
+			return wrongSCVal(val, t, path)
+		} else if !bigFits(x, uint(t.Bits()), false) {
+			return scvalErr(path, "%s %s out of range for Go type %s",
+				val.Type, x, t)
+		}
+		v.SetUint(x.Uint64())
+		return nil
+	case reflect.String:
+		switch val.Type {
+		case stx.SCV_STRING:
+			v.SetString(*val.Str())
+		case stx.SCV_SYMBOL:
+			v.SetString(*val.Sym())
+		default:
+			return wrongSCVal(val, t, path)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && val.Type == stx.SCV_BYTES {
+			b := *val.Bytes()
+			if v.Kind() == reflect.Slice {
+				v.Set(reflect.MakeSlice(t, len(b), len(b)))
+			} else if len(b) != v.Len() {
+				return scvalErr(path, "%d bytes do not fit Go type %s",
+					len(b), t)
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		} else if val.Type != stx.SCV_VEC {
+			return wrongSCVal(val, t, path)
+		}
+		vec := scvalVec(val)
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(vec), len(vec)))
+		} else if len(vec) != v.Len() {
+			return scvalErr(path, "vector of length %d does not fit "+
+				"Go type %s", len(vec), t)
+		}
+		for i := range vec {
+			if err := fromSCVal(&vec[i], v.Index(i),
+				fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if val.Type != stx.SCV_MAP {
+			return wrongSCVal(val, t, path)
+		}
+		m := reflect.MakeMap(t)
+		for _, e := range scvalMap(val) {
+			kpath := fmt.Sprintf("%s[%s]", path, scvalString(&e.Key))
+			k := reflect.New(t.Key()).Elem()
+			if err := fromSCVal(&e.Key, k, kpath); err != nil {
+				return err
+			}
+			ev := reflect.New(t.Elem()).Elem()
+			if err := fromSCVal(&e.Val, ev, kpath); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, ev)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		if val.Type != stx.SCV_MAP {
+			return wrongSCVal(val, t, path)
+		}
+		fields := make(map[string]int)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name, _, ok, err := scvalField(&f); err != nil {
+				return scvalErr(path+"."+f.Name, "%s", err)
+			} else if ok {
+				fields[name] = i
+			}
+		}
+		for _, e := range scvalMap(val) {
+			if e.Key.Type != stx.SCV_SYMBOL {
+				return scvalErr(path, "struct keys must be symbols, not %s",
+					e.Key.Type)
+			}
+			i, ok := fields[*e.Key.Sym()]
+			if !ok {
+				return scvalErr(path, "Go type %s has no field for key %q",
+					t, *e.Key.Sym())
+			}
+			if err := fromSCVal(&e.Val, v.Field(i),
+				path+"."+t.Field(i).Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return scvalErr(path, "cannot convert SCVal to Go type %s", t)
+}
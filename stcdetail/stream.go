@@ -31,12 +31,12 @@ func (e *HTTPerror) Error() string {
 	return e.Resp.Status
 }
 
-// Returns true for 503, false otherwise.  Should examine the result
-// more carefully to distinguish between transient or permanent 500
-// errors.
+// Returns true for 429, 502, 503, and 504, false otherwise.  Should
+// examine the result more carefully to distinguish between transient
+// or permanent 500 errors.
 func (e *HTTPerror) Temporary() bool {
 	switch e.Resp.StatusCode {
-	case 503:
+	case 429, 502, 503, 504:
 		return true
 	}
 	return false
@@ -116,6 +116,19 @@ needs to reconnect.
 */
 func Stream(ctx context.Context, url string,
 	cb func(eventType string, data []byte) error) error {
+	return StreamWithClient(ctx, nil, nil, url, cb)
+}
+
+// Like Stream, but uses client to make HTTP requests, and retries
+// failed connection attempts according to retry.  If client is nil,
+// uses http.DefaultClient.  If retry is nil, returns the first error
+// connecting.
+func StreamWithClient(ctx context.Context, client *http.Client,
+	retry *RetryPolicy, url string,
+	cb func(eventType string, data []byte) error) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
@@ -140,15 +153,22 @@ func Stream(ctx context.Context, url string,
 	}
 	defer cleanup()
 
-	for ctx.Err() == nil {
+	for attempt := 1; ctx.Err() == nil; {
 		cleanup()
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil || ctx.Err() != nil {
-			return err
+		resp, err = client.Do(req)
+		if err == nil && resp.StatusCode != 200 {
+			err = NewHTTPerror(resp)
 		}
-		if resp.StatusCode != 200 {
-			return NewHTTPerror(resp)
+		if ctx.Err() != nil {
+			return err
+		} else if err != nil {
+			if !retry.Wait(ctx, attempt, err) {
+				return err
+			}
+			attempt++
+			continue
 		}
+		attempt = 1
 		body := bufio.NewScanner(resp.Body)
 
 		var event streamEvent
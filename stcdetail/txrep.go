@@ -9,6 +9,8 @@ import (
 	"github.com/xdrpp/goxdr/xdr"
 	"github.com/xdrpp/stc/stx"
 	"io"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -239,6 +241,140 @@ func ScaleFmt(val int64, exp int) string {
 	return out + "e" + fmt.Sprintf("%d", exp)
 }
 
+type badScaledNumber string
+
+func (e badScaledNumber) Error() string {
+	return fmt.Sprintf("invalid decimal number %q", string(e))
+}
+
+// Parse a decimal number and return it multiplied by 10^exp.  The
+// number may contain commas between groups of three digits and may
+// end with an explicit exponent "eN", which is used instead of exp.
+// Hence ScaleParse parses the output of ScaleFmt regardless of exp.
+// Fails if the result is not an integer or does not fit in an int64.
+func ScaleParse(s string, exp int) (int64, error) {
+	num := s
+	if i := strings.LastIndexAny(num, "eE"); i >= 0 {
+		n, err := strconv.Atoi(num[i+1:])
+		if err != nil {
+			return 0, badScaledNumber(s)
+		}
+		num, exp = num[:i], n
+	}
+	neg := false
+	if len(num) > 0 && (num[0] == '-' || num[0] == '+') {
+		neg = num[0] == '-'
+		num = num[1:]
+	}
+	whole, frac := num, ""
+	if i := strings.IndexByte(num, '.'); i >= 0 {
+		whole, frac = num[:i], num[i+1:]
+	}
+	if strings.IndexByte(whole, ',') >= 0 {
+		groups := strings.Split(whole, ",")
+		for i, g := range groups {
+			if len(g) == 0 || len(g) > 3 || i > 0 && len(g) != 3 {
+				return 0, badScaledNumber(s)
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	digits := whole + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return 0, badScaledNumber(s)
+	}
+	exp -= len(frac)
+	for exp < 0 && len(digits) > 0 && digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+		exp++
+	}
+	if exp < 0 {
+		return 0, fmt.Errorf("%q is not a whole number when scaled", s)
+	}
+
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	var mag uint64
+	if digits = strings.TrimLeft(digits, "0"); digits != "" {
+		var err error
+		if mag, err = strconv.ParseUint(digits, 10, 64); err != nil ||
+			mag > limit || exp >= len(exp10) || mag > limit/exp10[exp] {
+			return 0, fmt.Errorf("%q is out of range", s)
+		}
+		mag *= exp10[exp]
+	}
+	if neg {
+		return -int64(mag), nil
+	}
+	return int64(mag), nil
+}
+
+// Formats other than Unix times accepted by ParseTimePoint.  Times
+// without a zone are interpreted in the local time zone.
+var DateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102150405",
+	"200601021504",
+	"20060102",
+}
+
+// Parse a TimePoint, which may be a date in one of DateFormats, a
+// Unix time (in seconds), or a duration (as accepted by
+// ParseDuration) preceded by "+" or "-" to specify a time relative to
+// now.  Since some DateFormats consist only of digits, a number is
+// only taken as a Unix time if it is not a valid date in one of
+// those formats, which no Unix time between 1974 and 5138 is.
+func ParseTimePoint(s string, now time.Time) (uint64, error) {
+	var t time.Time
+	var err error
+	if len(s) > 1 && (s[0] == '+' || s[0] == '-') {
+		var d uint64
+		if d, err = ParseDuration(s[1:]); err == nil {
+			if s[0] == '-' {
+				t = now.Add(-time.Duration(d) * time.Second)
+			} else {
+				t = now.Add(time.Duration(d) * time.Second)
+			}
+		}
+	} else {
+		for _, f := range DateFormats {
+			if t, err = time.ParseInLocation(f, s, time.Local); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse date %q", s)
+	} else if t.Unix() < 0 {
+		return 0, fmt.Errorf("date %q is before 1970", s)
+	}
+	return uint64(t.Unix()), nil
+}
+
+// Parse a Duration, which may be a number of seconds or a string
+// accepted by time.ParseDuration such as "1h30m".  Returns the
+// number of seconds.
+func ParseDuration(s string) (uint64, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || d%time.Second != 0 {
+		return 0, fmt.Errorf("cannot parse duration %q", s)
+	}
+	return uint64(d / time.Second), nil
+}
+
 func dateComment(ut uint64) string {
 	it := int64(ut)
 	if it <= 0 {
@@ -551,6 +687,52 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 			xs.report(lv.line, "%s (%d) exceeds maximum size %d.",
 				xs.length(), size, v.XdrBound())
 		}
+	case stx.XdrType_TimePoint:
+		if !ok {
+			return
+		}
+		var word string
+		fmt.Sscan(val, &word)
+		if n, err := ParseTimePoint(word, time.Now()); err != nil {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s", err.Error())
+		} else {
+			v.SetU64(n)
+		}
+	case stx.XdrType_Duration:
+		if !ok {
+			return
+		}
+		var word string
+		fmt.Sscan(val, &word)
+		if n, err := ParseDuration(word); err != nil {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s", err.Error())
+		} else {
+			v.SetU64(n)
+		}
+	case stx.XdrType_Int64:
+		if !ok {
+			return
+		}
+		var word string
+		fmt.Sscan(val, &word)
+		if strings.IndexByte(word, '.') >= 0 &&
+			!strings.ContainsAny(word, "eE") {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s is in stroops; write %se7 for units",
+				word, word)
+		} else if strings.ContainsAny(word, "eE,") {
+			if n, err := ScaleParse(word, 0); err != nil {
+				xs.setHelp(name)
+				xs.report(lv.line, "%s", err.Error())
+			} else {
+				v.SetU64(uint64(n))
+			}
+		} else if _, err := fmt.Sscan(val, v); err != nil {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s", err.Error())
+		}
 	case fmt.Scanner:
 		if !ok {
 			return
@@ -717,3 +899,64 @@ func GetTxrepField(t xdr.XdrType, field string) (ret xdr.XdrType) {
 	t.XdrMarshal(&xe, "")
 	return xe.result
 }
+
+type xdrWalker struct {
+	fn func(string, xdr.XdrType) bool
+	txrState
+}
+
+func (*xdrWalker) Sprintf(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func (xw *xdrWalker) Marshal(field string, i xdr.XdrType) {
+	xw.push(field, i)
+	defer xw.pop()
+	if v, ok := i.(xdr.XdrAggregate); ok && !xw.fn(xw.name(), i) {
+		v.XdrRecurse(xw, "")
+	} else if !ok {
+		xw.fn(xw.name(), i)
+	}
+}
+
+// Like ForEachXdr, but also passes fn the txrep name of each value.
+// Calls fn, recursively, on every value inside an XdrType, visiting
+// aggregates before the values they contain.  Prunes the recursion if
+// fn returns true.
+func ForEachTxrepField(t xdr.XdrType, name string,
+	fn func(field string, i xdr.XdrType) bool) {
+	t.XdrMarshal(&xdrWalker{fn: fn}, name)
+}
+
+// Convert XdrBadValue to a TxrepError by finding the line of each
+// field in txrep input.  A field that is not itself a line of the
+// input (such as a structure) is reported at the first line of any
+// field it contains, or else at the line of its closest enclosing
+// field, or at line 0 if there is none.
+func (e XdrBadValue) TxrepError(in io.Reader) TxrepError {
+	xs := &xdrScan{}
+	xs.readKvs(in)
+	ret := make(TxrepError, len(e))
+	for i := range e {
+		ret[i].Msg = fmt.Sprintf("%s: %s", e[i].Field, e[i].Msg)
+		for f := e[i].Field; f != "" && ret[i].Line == 0; {
+			if lv, ok := xs.kvs[f]; ok {
+				ret[i].Line = lv.line
+				break
+			}
+			for k, lv := range xs.kvs {
+				if (ret[i].Line == 0 || lv.line < ret[i].Line) &&
+					len(k) > len(f) && strings.HasPrefix(k, f) &&
+					(k[len(f)] == '.' || k[len(f)] == '[') {
+					ret[i].Line = lv.line
+				}
+			}
+			if j := strings.LastIndexAny(f, ".["); j >= 0 {
+				f = f[:j]
+			} else {
+				f = ""
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+package stcdetail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var ErrNotWasm = errors.New("Not a WebAssembly module")
+
+var wasmMagic = []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+
+// Reads an unsigned LEB128 integer of at most 32 bits.
+func wasmU32(in []byte) (uint32, []byte, error) {
+	var ret uint32
+	for i := 0; i < 5 && i < len(in); i++ {
+		ret |= uint32(in[i]&0x7f) << (7 * uint(i))
+		if in[i]&0x80 == 0 {
+			return ret, in[i+1:], nil
+		}
+	}
+	return 0, nil, errors.New("Invalid LEB128 integer in WebAssembly")
+}
+
+// Returns the contents of all custom sections with a particular name
+// in a WebAssembly module, concatenated in the order they appear.
+// Returns nil if there are no such sections.
+func WasmCustomSection(wasm []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(wasm, wasmMagic) {
+		return nil, ErrNotWasm
+	}
+	var ret []byte
+	for in := wasm[len(wasmMagic):]; len(in) > 0; {
+		id := in[0]
+		size, rest, err := wasmU32(in[1:])
+		if err != nil {
+			return nil, err
+		} else if uint64(size) > uint64(len(rest)) {
+			return nil, fmt.Errorf("Truncated WebAssembly section %d", id)
+		}
+		sec := rest[:size]
+		in = rest[size:]
+		if id != 0 {
+			continue
+		}
+		n, sec, err := wasmU32(sec)
+		if err != nil {
+			return nil, err
+		} else if uint64(n) > uint64(len(sec)) {
+			return nil, errors.New("Truncated WebAssembly section name")
+		} else if string(sec[:n]) == name {
+			ret = append(ret, sec[n:]...)
+		}
+	}
+	return ret, nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/xdrpp/stc/ini"
 	"github.com/xdrpp/stc/stcdetail"
 	"github.com/xdrpp/stc/stx"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -24,6 +25,28 @@ type StellarNet struct {
 	// Base URL of horizon (including trailing slash).
 	Horizon string
 
+	// Base URLs of additional horizon servers to use, in order, when
+	// Horizon is down or returns a temporary error.  A transaction is
+	// only posted to a fallback if no connection could be made to the
+	// previous servers, so it is never submitted twice.
+	HorizonFallbacks []string
+
+	// If true, spread read requests over all healthy horizon servers
+	// rather than always preferring the first.
+	HorizonRoundRobin bool
+
+	// Base URL of the Soroban RPC server.
+	RPC string
+
+	// HTTP client used for all requests to horizon and Soroban RPC.
+	// If nil, http.DefaultClient is used.  Set this to add timeouts, a
+	// proxy, or a custom http.RoundTripper (e.g., to inject headers).
+	HTTPClient *http.Client
+
+	// How to retry failed requests to horizon or Soroban RPC.  If nil,
+	// DefaultRetryPolicy is used.
+	RetryPolicy *RetryPolicy
+
 	// Set of signers to recognize when checking signatures on
 	// transactions and annotations to show when printing signers.
 	Signers SignerCache
@@ -41,6 +64,9 @@ type StellarNet struct {
 	// Cache of fee stats
 	FeeCache     *FeeStats
 	FeeCacheTime time.Time
+
+	// How UpdateFee chooses transaction fees.
+	FeeStrategy FeeStrategy
 }
 
 func (net *StellarNet) AddHint(acct string, hint string) {
@@ -144,3 +144,27 @@ func (tx *TransactionEnvelope) Operations() *[]Operation {
 	}
 	return nil
 }
+
+func (c *Preconditions) timeBounds() *TimeBounds {
+	switch c.Type {
+	case PRECOND_TIME:
+		return c.TimeBounds()
+	case PRECOND_V2:
+		return c.V2().TimeBounds
+	}
+	return nil
+}
+
+// Returns the time bounds of the transaction (or of the inner
+// transaction of a fee bump), or nil if it has none.
+func (tx *TransactionEnvelope) TimeBounds() *TimeBounds {
+	switch tx.Type {
+	case ENVELOPE_TYPE_TX_V0:
+		return tx.V0().Tx.TimeBounds
+	case ENVELOPE_TYPE_TX:
+		return tx.V1().Tx.Cond.timeBounds()
+	case ENVELOPE_TYPE_TX_FEE_BUMP:
+		return tx.FeeBump().Tx.InnerTx.V1().Tx.Cond.timeBounds()
+	}
+	return nil
+}
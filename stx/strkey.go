@@ -9,6 +9,7 @@ package stx
 import (
 	"bytes"
 	"encoding/base32"
+	"encoding/hex"
 	"fmt"
 	"github.com/xdrpp/goxdr/xdr"
 	"io"
@@ -34,6 +35,9 @@ const (
 	STRKEY_PRE_AUTH_TX StrKeyVersionByte = 19 << 3 // 'T',
 	STRKEY_HASH_X	   StrKeyVersionByte = 23 << 3 // 'X'
 	STRKEY_SIGNED_PAYLOAD StrKeyVersionByte = 15 << 3 // 'P'
+	STRKEY_CONTRACT	   StrKeyVersionByte = 2 << 3  // 'C'
+	STRKEY_LIQUIDITY_POOL StrKeyVersionByte = 11 << 3 // 'L'
+	STRKEY_CLAIMABLE_BALANCE StrKeyVersionByte = 1 << 3 // 'B'
 	STRKEY_ERROR	   StrKeyVersionByte = 255
 )
 
@@ -44,6 +48,9 @@ var payloadLen = map[StrKeyVersionByte]int{
 	STRKEY_PRE_AUTH_TX:					 32,
 	STRKEY_HASH_X:						 32,
 	STRKEY_SIGNED_PAYLOAD:				 -1,
+	STRKEY_CONTRACT:					 32,
+	STRKEY_LIQUIDITY_POOL:				 32,
+	STRKEY_CLAIMABLE_BALANCE:			 33,
 }
 
 var crc16table [256]uint16
@@ -180,6 +187,49 @@ func (pk SignerKey) String() string {
 	}
 }
 
+// Renders a contract ID in strkey format.
+func (v XdrType_ContractID) String() string {
+	return ToStrKey(STRKEY_CONTRACT, v.GetByteSlice())
+}
+
+// Renders a liquidity pool ID in strkey format.
+func (v XdrType_PoolID) String() string {
+	return ToStrKey(STRKEY_LIQUIDITY_POOL, v.GetByteSlice())
+}
+
+// Renders a ClaimableBalanceID in strkey format.
+func (id ClaimableBalanceID) String() string {
+	switch id.Type {
+	case CLAIMABLE_BALANCE_ID_TYPE_V0:
+		// The version byte of the strkey payload is the low byte of
+		// the discriminant
+		return ToStrKey(STRKEY_CLAIMABLE_BALANCE,
+			append([]byte{byte(id.Type)}, id.V0()[:]...))
+	default:
+		return fmt.Sprintf("ClaimableBalanceID.Type#%d", int32(id.Type))
+	}
+}
+
+// Renders an SCAddress in strkey format.
+func (a SCAddress) String() string {
+	switch a.Type {
+	case SC_ADDRESS_TYPE_ACCOUNT:
+		return a.AccountId().String()
+	case SC_ADDRESS_TYPE_CONTRACT:
+		return XDR_ContractID(a.ContractId()).String()
+	case SC_ADDRESS_TYPE_MUXED_ACCOUNT:
+		return ToStrKey(STRKEY_MUXED|STRKEY_ALG_ED25519,
+			XdrToBytes(XDR_Uint256(&a.MuxedAccount().Ed25519),
+				XDR_Uint64(&a.MuxedAccount().Id)))
+	case SC_ADDRESS_TYPE_CLAIMABLE_BALANCE:
+		return a.ClaimableBalanceId().String()
+	case SC_ADDRESS_TYPE_LIQUIDITY_POOL:
+		return XDR_PoolID(a.LiquidityPoolId()).String()
+	default:
+		return fmt.Sprintf("SCAddress.Type#%d", int32(a.Type))
+	}
+}
+
 func renderByte(b byte) string {
 	if b <= ' ' || b >= '\x7f' {
 		return fmt.Sprintf("\\x%02x", b)
@@ -400,6 +450,121 @@ func (pk *SignerKey) Scan(ss fmt.ScanState, _ rune) error {
 	return pk.UnmarshalText(bs)
 }
 
+// Parses a contract ID in strkey format.
+func (v XdrType_ContractID) Scan(ss fmt.ScanState, _ rune) error {
+	bs, err := ss.Token(true, IsStrKeyChar)
+	if err != nil {
+		return err
+	}
+	return v.UnmarshalText(bs)
+}
+
+// Parses a liquidity pool ID in strkey format or as 64 hex digits.
+func (v XdrType_PoolID) Scan(ss fmt.ScanState, _ rune) error {
+	bs, err := ss.Token(true, func(c rune) bool {
+		return IsStrKeyChar(c) || c >= 'a' && c <= 'f'
+	})
+	if err != nil {
+		return err
+	}
+	return v.UnmarshalText(bs)
+}
+
+// Parses a ClaimableBalanceID in strkey format or as 72 hex digits
+// (its XDR encoding).
+func (id *ClaimableBalanceID) Scan(ss fmt.ScanState, _ rune) error {
+	bs, err := ss.Token(true, func(c rune) bool {
+		return IsStrKeyChar(c) || c >= 'a' && c <= 'f'
+	})
+	if err != nil {
+		return err
+	}
+	return id.UnmarshalText(bs)
+}
+
+// Parses an SCAddress in strkey format.
+func (a *SCAddress) Scan(ss fmt.ScanState, _ rune) error {
+	bs, err := ss.Token(true, IsStrKeyChar)
+	if err != nil {
+		return err
+	}
+	return a.UnmarshalText(bs)
+}
+
+// Parses a contract ID in strkey format.
+func (v XdrType_ContractID) UnmarshalText(bs []byte) error {
+	key, vers := FromStrKey(bs)
+	if vers != STRKEY_CONTRACT {
+		return StrKeyError("Invalid contract ID")
+	}
+	copy(v.GetByteSlice(), key)
+	return nil
+}
+
+// Parses a liquidity pool ID in strkey format or as 64 hex digits.
+func (v XdrType_PoolID) UnmarshalText(bs []byte) error {
+	if len(bs) == 2*len(v.GetByteSlice()) {
+		if _, err := hex.Decode(v.GetByteSlice(), bs); err == nil {
+			return nil
+		}
+	}
+	key, vers := FromStrKey(bs)
+	if vers != STRKEY_LIQUIDITY_POOL {
+		return StrKeyError("Invalid liquidity pool ID")
+	}
+	copy(v.GetByteSlice(), key)
+	return nil
+}
+
+// Parses a ClaimableBalanceID in strkey format or as 72 hex digits
+// (its XDR encoding).
+func (id *ClaimableBalanceID) UnmarshalText(bs []byte) error {
+	var raw [4 + len(Hash{})]byte
+	if len(bs) == 2*len(raw) {
+		if _, err := hex.Decode(raw[:], bs); err == nil &&
+			ClaimableBalanceIDType(raw[3]) == CLAIMABLE_BALANCE_ID_TYPE_V0 &&
+			raw[0]|raw[1]|raw[2] == 0 {
+			id.Type = CLAIMABLE_BALANCE_ID_TYPE_V0
+			copy(id.V0()[:], raw[4:])
+			return nil
+		}
+	}
+	key, vers := FromStrKey(bs)
+	if vers != STRKEY_CLAIMABLE_BALANCE ||
+		ClaimableBalanceIDType(key[0]) != CLAIMABLE_BALANCE_ID_TYPE_V0 {
+		return StrKeyError("Invalid claimable balance ID")
+	}
+	id.Type = CLAIMABLE_BALANCE_ID_TYPE_V0
+	copy(id.V0()[:], key[1:])
+	return nil
+}
+
+// Parses an SCAddress in strkey format.
+func (a *SCAddress) UnmarshalText(bs []byte) error {
+	key, vers := FromStrKey(bs)
+	switch vers {
+	case STRKEY_PUBKEY | STRKEY_ALG_ED25519:
+		a.Type = SC_ADDRESS_TYPE_ACCOUNT
+		return a.AccountId().UnmarshalText(bs)
+	case STRKEY_CONTRACT:
+		a.Type = SC_ADDRESS_TYPE_CONTRACT
+		copy(a.ContractId()[:], key)
+	case STRKEY_MUXED | STRKEY_ALG_ED25519:
+		a.Type = SC_ADDRESS_TYPE_MUXED_ACCOUNT
+		return XdrFromBytes(key, XDR_Uint256(&a.MuxedAccount().Ed25519),
+			XDR_Uint64(&a.MuxedAccount().Id))
+	case STRKEY_CLAIMABLE_BALANCE:
+		a.Type = SC_ADDRESS_TYPE_CLAIMABLE_BALANCE
+		return a.ClaimableBalanceId().UnmarshalText(bs)
+	case STRKEY_LIQUIDITY_POOL:
+		a.Type = SC_ADDRESS_TYPE_LIQUIDITY_POOL
+		copy(a.LiquidityPoolId()[:], key)
+	default:
+		return StrKeyError("Invalid address")
+	}
+	return nil
+}
+
 // Parses a public key in strkey format.
 func (pk *PublicKey) UnmarshalText(bs []byte) error {
 	key, vers := FromStrKey(bs)
@@ -0,0 +1,132 @@
+package stc
+
+import (
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+func validVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' ||
+			i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Substitute variables in one line of a template.
+func expandTemplateLine(line string, vars,
+	defaults map[string]string) (string, error) {
+	out := &strings.Builder{}
+	for {
+		i := strings.IndexByte(line, '$')
+		if i < 0 {
+			out.WriteString(line)
+			return out.String(), nil
+		}
+		out.WriteString(line[:i])
+		line = line[i+1:]
+		switch {
+		case strings.HasPrefix(line, "$"):
+			out.WriteByte('$')
+			line = line[1:]
+			continue
+		case !strings.HasPrefix(line, "{"):
+			return "", fmt.Errorf("'$' must be followed by '{' or '$'")
+		}
+		j := strings.IndexByte(line, '}')
+		if j < 0 {
+			return "", fmt.Errorf("unterminated ${")
+		}
+		name := line[1:j]
+		line = line[j+1:]
+		val, ok := vars[name]
+		if !ok {
+			val, ok = defaults[name]
+		}
+		if !validVarName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		} else if !ok {
+			return "", fmt.Errorf("variable %s is not set", name)
+		} else if strings.ContainsAny(val, "\r\n") {
+			return "", fmt.Errorf("value of %s contains a newline", name)
+		}
+		out.WriteString(val)
+	}
+}
+
+/*
+Render a transaction template and parse the result as txrep.  A
+template is a txrep file in which each "${NAME}" is replaced by the
+value of variable NAME from vars, and "$$" is replaced by a single
+"$".  The template may start with a header of lines of the form
+"$NAME: VALUE", which give default values for variables not in vars.
+For example:
+
+	$memo: payroll
+	type: ENVELOPE_TYPE_TX
+	tx.sourceAccount: GBD3...
+	tx.memo.type: MEMO_TEXT
+	tx.memo.text: "${memo}"
+	tx.operations.len: 1
+	tx.operations[0].sourceAccount._present: false
+	tx.operations[0].body.type: PAYMENT
+	tx.operations[0].body.paymentOp.destination: ${dest}
+	tx.operations[0].body.paymentOp.asset: native
+	tx.operations[0].body.paymentOp.amount: ${amount}e7
+
+Errors, including errors parsing the rendered txrep, are reported as
+a stcdetail.TxrepError with the line numbers of the template.
+*/
+func RenderTxrepTemplate(r io.Reader,
+	vars map[string]string) (*TransactionEnvelope, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(input), "\n")
+	var errs stcdetail.TxrepError
+	report := func(i int, err error) {
+		errs = append(errs, struct {
+			Line int
+			Msg  string
+		}{i + 1, err.Error()})
+	}
+
+	defaults := make(map[string]string)
+	i := 0
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		} else if line[0] != '$' || strings.HasPrefix(line, "${") ||
+			strings.HasPrefix(line, "$$") {
+			break
+		}
+		kv := strings.SplitN(line[1:], ":", 2)
+		if name := strings.TrimSpace(kv[0]); len(kv) != 2 ||
+			!validVarName(name) {
+			report(i, fmt.Errorf("invalid default (must be $NAME: VALUE)"))
+		} else {
+			defaults[name] = strings.TrimSpace(kv[1])
+		}
+		lines[i] = ""
+	}
+	for ; i < len(lines); i++ {
+		if lines[i], err = expandTemplateLine(lines[i], vars,
+			defaults); err != nil {
+			report(i, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return TxFromRep(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,220 @@
+package stc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"time"
+)
+
+// Minimum per-operation fee (in stroops) assumed by ValidateTx when
+// the network's fee statistics have not been cached.
+const minBaseFee = 100
+
+// Returns a description of what is wrong with an asset code, or ""
+// if the code is valid.  A code consists of at least minLen ASCII
+// letters and digits, padded at the end with zero bytes.
+func badAssetCode(code []byte, minLen int) string {
+	n := bytes.IndexByte(code, 0)
+	if n < 0 {
+		n = len(code)
+	}
+	if n < minLen {
+		return fmt.Sprintf("asset code must have at least %d characters",
+			minLen)
+	}
+	for i, c := range code {
+		if i >= n {
+			if c != 0 {
+				return "asset code has characters after a zero byte"
+			}
+		} else if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' ||
+			c >= '0' && c <= '9') {
+			return "asset code may contain only letters and digits"
+		}
+	}
+	return ""
+}
+
+// Perform sanity checks on a transaction that do not require any
+// access to the network, so as to catch mistakes before signing.
+// Problems are returned keyed by txrep field name (so that
+// XdrBadValue's TxrepError method can map them to lines of a txrep
+// file).  Returns nil if no problems are found.  The checks are:
+// a fee below the base fee times the number of operations (using
+// cached fee statistics if available), a zero sequence number,
+// expired or inverted time bounds, too many operations, invalid asset
+// codes, payments to the operation's own source account, text memos
+// over 28 bytes, signatures in the envelope that do not match the
+// payload or hash of an extraSigners entry, and ChangeTrust
+// operations on the native asset.
+func (net *StellarNet) ValidateTx(e *TransactionEnvelope) stcdetail.XdrBadValue {
+	var ret stcdetail.XdrBadValue
+	report := func(field string, f string, args ...interface{}) {
+		ret = append(ret, struct {
+			Field string
+			Msg   string
+		}{field, fmt.Sprintf(f, args...)})
+	}
+
+	baseFee := int64(minBaseFee)
+	if net.FeeCache != nil && net.FeeCache.Last_ledger_base_fee > 0 {
+		baseFee = int64(net.FeeCache.Last_ledger_base_fee)
+	}
+	checkFee := func(field string, fee, nops int64) {
+		if min := baseFee * nops; fee < min {
+			report(field, "fee %d is below base fee %d times %d operations",
+				fee, baseFee, nops)
+		}
+	}
+	checkOps := func(name string, ops []stx.Operation) {
+		if len(ops) > stx.MAX_OPS_PER_TX {
+			report(name+".operations.len",
+				"%d operations exceeds the maximum of %d",
+				len(ops), stx.MAX_OPS_PER_TX)
+		}
+	}
+
+	now := uint64(time.Now().Unix())
+	var sigs []stx.DecoratedSignature
+	var txSource, opSource stx.MuxedAccount
+	stcdetail.ForEachTxrepField(e.TransactionEnvelope, "",
+		func(name string, i xdr.XdrType) bool {
+			switch v := i.(type) {
+			case *stx.TransactionV0Envelope:
+				sigs = v.Signatures
+			case *stx.TransactionV1Envelope:
+				sigs = v.Signatures
+			case *stx.FeeBumpTransaction:
+				if v.InnerTx.Type == stx.ENVELOPE_TYPE_TX {
+					checkFee(name+".fee", int64(v.Fee),
+						int64(len(v.InnerTx.V1().Tx.Operations)+1))
+				}
+			case *stx.TransactionV0:
+				txSource = stx.MuxedAccount{Type: stx.KEY_TYPE_ED25519}
+				*txSource.Ed25519() = v.SourceAccountEd25519
+				checkFee(name+".fee", int64(v.Fee), int64(len(v.Operations)))
+				if v.SeqNum == 0 {
+					report(name+".seqNum", "sequence number is zero")
+				}
+				checkOps(name, v.Operations)
+			case *stx.Transaction:
+				txSource = v.SourceAccount
+				fee := int64(v.Fee)
+				if v.Ext.V == 1 {
+					fee -= int64(v.Ext.SorobanData().ResourceFee)
+				}
+				checkFee(name+".fee", fee, int64(len(v.Operations)))
+				if v.SeqNum == 0 {
+					report(name+".seqNum", "sequence number is zero")
+				}
+				checkOps(name, v.Operations)
+			case *stx.TimeBounds:
+				if v.MaxTime != 0 && v.MinTime > v.MaxTime {
+					report(name+".minTime", "minTime is after maxTime")
+				} else if v.MaxTime != 0 && uint64(v.MaxTime) < now {
+					report(name+".maxTime", "maxTime has already passed")
+				}
+			case *stx.Memo:
+				if v.Type == stx.MEMO_TEXT && len(*v.Text()) > 28 {
+					report(name+".text", "memo text is %d bytes (maximum 28)",
+						len(*v.Text()))
+				}
+			case *stx.PreconditionsV2:
+				for j := range v.ExtraSigners {
+					checkExtraSigner(fmt.Sprintf("%s.extraSigners[%d]", name, j),
+						&v.ExtraSigners[j], sigs, report)
+				}
+			case *stx.Operation:
+				opSource = txSource
+				if v.SourceAccount != nil {
+					opSource = *v.SourceAccount
+				}
+			case *stx.PaymentOp:
+				if sameAccount(&v.Destination, &opSource) {
+					report(name+".destination",
+						"payment to the operation's own source account")
+				}
+			case *stx.ChangeTrustOp:
+				if v.Line.Type == stx.ASSET_TYPE_NATIVE {
+					report(name+".line", "cannot change trust in native asset")
+				}
+			case *stx.Asset:
+				checkAssetCode(name, v.Type, v, report)
+			case *stx.ChangeTrustAsset:
+				checkAssetCode(name, v.Type, v, report)
+			case *stx.TrustLineAsset:
+				checkAssetCode(name, v.Type, v, report)
+			case *stx.AssetCode:
+				switch v.Type {
+				case stx.ASSET_TYPE_CREDIT_ALPHANUM4:
+					if msg := badAssetCode(v.AssetCode4()[:], 1); msg != "" {
+						report(name, "%s", msg)
+					}
+				case stx.ASSET_TYPE_CREDIT_ALPHANUM12:
+					if msg := badAssetCode(v.AssetCode12()[:], 5); msg != "" {
+						report(name, "%s", msg)
+					}
+				}
+			}
+			return false
+		})
+	return ret
+}
+
+// Checks the code of an Asset, ChangeTrustAsset, or TrustLineAsset.
+func checkAssetCode(name string, t stx.AssetType, a interface{},
+	report func(string, string, ...interface{})) {
+	var msg string
+	switch t {
+	case stx.ASSET_TYPE_CREDIT_ALPHANUM4:
+		an := a.(interface{ AlphaNum4() *stx.AlphaNum4 }).AlphaNum4()
+		msg = badAssetCode(an.AssetCode[:], 1)
+	case stx.ASSET_TYPE_CREDIT_ALPHANUM12:
+		an := a.(interface{ AlphaNum12() *stx.AlphaNum12 }).AlphaNum12()
+		msg = badAssetCode(an.AssetCode[:], 5)
+	}
+	if msg != "" {
+		report(name, "%s", msg)
+	}
+}
+
+// Reports signatures that have the hint of a signed payload or hash-X
+// extra signer but do not match its payload or hash.
+func checkExtraSigner(name string, signer *stx.SignerKey,
+	sigs []stx.DecoratedSignature,
+	report func(string, string, ...interface{})) {
+	hint := signer.Hint()
+	for j := range sigs {
+		if sigs[j].Hint != hint {
+			continue
+		}
+		switch signer.Type {
+		case stx.SIGNER_KEY_TYPE_ED25519_SIGNED_PAYLOAD:
+			spl := signer.Ed25519SignedPayload()
+			pk := stx.PublicKey{Type: stx.PUBLIC_KEY_TYPE_ED25519}
+			*pk.Ed25519() = spl.Ed25519
+			if !stcdetail.Verify(&pk, spl.Payload, sigs[j].Signature) {
+				report(name, "signatures[%d] does not sign this payload", j)
+			}
+		case stx.SIGNER_KEY_TYPE_HASH_X:
+			if sha256.Sum256(sigs[j].Signature) != *signer.HashX() {
+				report(name, "signatures[%d] does not match this hash", j)
+			}
+		}
+	}
+}
+
+// Returns true if two MuxedAccounts refer to the same Stellar
+// account, regardless of any multiplexed IDs.
+func sameAccount(a, b *stx.MuxedAccount) bool {
+	if a.Type != stx.KEY_TYPE_ED25519 && a.Type != stx.KEY_TYPE_MUXED_ED25519 ||
+		b.Type != stx.KEY_TYPE_ED25519 && b.Type != stx.KEY_TYPE_MUXED_ED25519 {
+		return false
+	}
+	ka, kb := a.ToSignerKey(), b.ToSignerKey()
+	return *ka.Ed25519() == *kb.Ed25519()
+}
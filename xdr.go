@@ -89,7 +89,7 @@ func (net *StellarNet) NewSignerPreauth(tx stx.Signable,
 // Create a signer that requires the hash pre-image of some hash value x
 func NewSignerHashX(x stx.Hash, weight uint32) *stx.Signer {
 	ret := stx.Signer{Weight: weight}
-	ret.Key.Type = stx.SIGNER_KEY_TYPE_PRE_AUTH_TX
+	ret.Key.Type = stx.SIGNER_KEY_TYPE_HASH_X
 	*ret.Key.HashX() = x
 	return &ret
 }
@@ -221,18 +221,31 @@ func (txe *TransactionEnvelope) Append(
 }
 
 // Set the fee of a transaction to baseFee times the number of
-// operations.  If the result would exceed the maximum fee of
+// operations, plus any Soroban resource fee already in the
+// transaction.  For a fee-bump transaction, the fee bump itself
+// counts as an extra operation, and the resource fee is that of the
+// inner transaction.  If the result would exceed the maximum fee of
 // 0xffffffff (~430 XLM), then just set the fee to 0xffffffff.
 // (Obviously only call this once you have finished adding operations
 // to the transaction with Append.)
 func (txe *TransactionEnvelope) SetFee(baseFee uint32) {
+	resourceFee := func(tx *stx.Transaction) int64 {
+		if tx.Ext.V == 1 {
+			return int64(tx.Ext.SorobanData().ResourceFee)
+		}
+		return 0
+	}
 	if txe.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
-		txe.FeeBump().Tx.Fee = int64(baseFee) *
-			int64(len(txe.FeeBump().Tx.InnerTx.V1().Tx.Operations))
+		inner := &txe.FeeBump().Tx.InnerTx.V1().Tx
+		txe.FeeBump().Tx.Fee = int64(baseFee)*
+			int64(len(inner.Operations)+1) + resourceFee(inner)
 		return
 	}
 	if ops := txe.Operations(); ops != nil {
 		fee := int64(baseFee) * int64(len(*ops))
+		if txe.Type == stx.ENVELOPE_TYPE_TX {
+			fee += resourceFee(&txe.V1().Tx)
+		}
 		fee32 := uint32(fee)
 		if fee > 0xffffffff {
 			fee32 = 0xffffffff
@@ -249,6 +262,47 @@ func (txe *TransactionEnvelope) SetFee(baseFee uint32) {
 	xdr.XdrPanic("SetFee: Invalid envelope type %s", txe.Type)
 }
 
+// Wrap a transaction in a fee-bump transaction, so that feeSource
+// pays a fee of up to maxFee.  (Note maxFee must cover one more
+// operation than the inner transaction contains, plus any Soroban
+// resource fee.)  The inner transaction keeps its signatures, which
+// remain valid.  A V0 inner transaction is converted to V1, which
+// does not change its hash.  Panics if inner is already a fee-bump
+// transaction.
+func NewFeeBump(inner *TransactionEnvelope, feeSource stx.IsAccount,
+	maxFee int64) *TransactionEnvelope {
+	ret := &TransactionEnvelope{
+		TransactionEnvelope: &stx.TransactionEnvelope{
+			Type: stx.ENVELOPE_TYPE_TX_FEE_BUMP,
+		},
+	}
+	fb := &ret.FeeBump().Tx
+	fb.FeeSource = *feeSource.ToMuxedAccount()
+	fb.Fee = maxFee
+	fb.InnerTx.Type = stx.ENVELOPE_TYPE_TX
+	v1 := fb.InnerTx.V1()
+	switch inner.Type {
+	case stx.ENVELOPE_TYPE_TX:
+		*v1 = *inner.V1()
+	case stx.ENVELOPE_TYPE_TX_V0:
+		v0 := inner.V0()
+		v1.Tx.SourceAccount = *inner.SourceAccount()
+		v1.Tx.Fee = v0.Tx.Fee
+		v1.Tx.SeqNum = v0.Tx.SeqNum
+		if v0.Tx.TimeBounds != nil {
+			v1.Tx.Cond.Type = stx.PRECOND_TIME
+			*v1.Tx.Cond.TimeBounds() = *v0.Tx.TimeBounds
+		}
+		v1.Tx.Memo = v0.Tx.Memo
+		v1.Tx.Operations = v0.Tx.Operations
+		v1.Signatures = v0.Signatures
+	default:
+		xdr.XdrPanic("NewFeeBump: cannot fee-bump envelope type %s",
+			inner.Type)
+	}
+	return ret
+}
+
 func (txe *TransactionEnvelope) SourceAccount() *stx.MuxedAccount {
 	switch txe.Type {
 	case stx.ENVELOPE_TYPE_TX_V0: